@@ -0,0 +1,255 @@
+package eio
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/byonchev/go-engine.io/internal/logger"
+	"github.com/byonchev/go-engine.io/internal/packet"
+	"github.com/byonchev/go-engine.io/internal/utils"
+)
+
+// Broadcast describes a message sent to multiple sessions
+type Broadcast struct {
+	// Rooms selects the recipients. All sessions receive the message if empty
+	Rooms []string `json:"rooms,omitempty"`
+
+	// Except lists the rooms whose sessions are skipped
+	Except []string `json:"except,omitempty"`
+
+	Binary bool   `json:"binary"`
+	Data   []byte `json:"data"`
+}
+
+// Adapter keeps room membership and delivers broadcasts to the sessions.
+// Every session joins the room named by its ID during the handshake
+type Adapter interface {
+	// Join adds the session to the room
+	Join(sessionID string, room string) error
+
+	// Leave removes the session from the room
+	Leave(sessionID string, room string) error
+
+	// Rooms returns the rooms joined by the session
+	Rooms(sessionID string) ([]string, error)
+
+	// Broadcast delivers the message to the selected sessions
+	Broadcast(message Broadcast) error
+}
+
+// Sender delivers messages to the sessions connected to the local node
+type Sender interface {
+	Send(sessionID string, binary bool, data []byte) error
+}
+
+// packetSender is implemented by senders writing a packet shared by all recipients,
+// so the broadcast is encoded once per codec instead of once per session
+type packetSender interface {
+	sendPacket(sessionID string, message packet.Packet) error
+}
+
+// MemoryAdapter keeps rooms in process and delivers broadcasts to local sessions only
+type MemoryAdapter struct {
+	sync.RWMutex
+
+	sender Sender
+
+	rooms    map[string]map[string]bool
+	sessions map[string]map[string]bool
+}
+
+// NewMemoryAdapter creates adapter delivering broadcasts through the sender
+func NewMemoryAdapter(sender Sender) *MemoryAdapter {
+	return &MemoryAdapter{
+		sender:   sender,
+		rooms:    make(map[string]map[string]bool),
+		sessions: make(map[string]map[string]bool),
+	}
+}
+
+// Join adds the session to the room
+func (adapter *MemoryAdapter) Join(sessionID string, room string) error {
+	adapter.Lock()
+	defer adapter.Unlock()
+
+	if adapter.rooms[room] == nil {
+		adapter.rooms[room] = make(map[string]bool)
+	}
+
+	if adapter.sessions[sessionID] == nil {
+		adapter.sessions[sessionID] = make(map[string]bool)
+	}
+
+	adapter.rooms[room][sessionID] = true
+	adapter.sessions[sessionID][room] = true
+
+	return nil
+}
+
+// Leave removes the session from the room
+func (adapter *MemoryAdapter) Leave(sessionID string, room string) error {
+	adapter.Lock()
+	defer adapter.Unlock()
+
+	delete(adapter.rooms[room], sessionID)
+	delete(adapter.sessions[sessionID], room)
+
+	if len(adapter.rooms[room]) == 0 {
+		delete(adapter.rooms, room)
+	}
+
+	if len(adapter.sessions[sessionID]) == 0 {
+		delete(adapter.sessions, sessionID)
+	}
+
+	return nil
+}
+
+// Rooms returns the rooms joined by the session
+func (adapter *MemoryAdapter) Rooms(sessionID string) ([]string, error) {
+	adapter.RLock()
+	defer adapter.RUnlock()
+
+	var rooms []string
+
+	for room := range adapter.sessions[sessionID] {
+		rooms = append(rooms, room)
+	}
+
+	return rooms, nil
+}
+
+// Broadcast sends the message to the selected local sessions.
+// Recipients are resolved under lock and the message is sent after the lock is released
+func (adapter *MemoryAdapter) Broadcast(message Broadcast) error {
+	recipients := adapter.recipients(message)
+
+	sender, shared := adapter.sender.(packetSender)
+	broadcast := packet.NewBroadcast(message.Binary, message.Data)
+
+	for _, sessionID := range recipients {
+		var err error
+
+		if shared {
+			err = sender.sendPacket(sessionID, broadcast)
+		} else {
+			err = adapter.sender.Send(sessionID, message.Binary, message.Data)
+		}
+
+		if err != nil {
+			logger.Debug("Broadcast to session ", sessionID, " failed: ", err)
+		}
+	}
+
+	return nil
+}
+
+func (adapter *MemoryAdapter) recipients(message Broadcast) []string {
+	adapter.RLock()
+	defer adapter.RUnlock()
+
+	excluded := make(map[string]bool)
+
+	for _, room := range message.Except {
+		for sessionID := range adapter.rooms[room] {
+			excluded[sessionID] = true
+		}
+	}
+
+	selected := make(map[string]bool)
+
+	if len(message.Rooms) == 0 {
+		for sessionID := range adapter.sessions {
+			selected[sessionID] = true
+		}
+	}
+
+	for _, room := range message.Rooms {
+		for sessionID := range adapter.rooms[room] {
+			selected[sessionID] = true
+		}
+	}
+
+	var recipients []string
+
+	for sessionID := range selected {
+		if !excluded[sessionID] {
+			recipients = append(recipients, sessionID)
+		}
+	}
+
+	return recipients
+}
+
+// Broker is a publish/subscribe bus shared by the server nodes
+type Broker interface {
+	// Publish sends the message to all subscribers of the channel
+	Publish(channel string, message []byte) error
+
+	// Subscribe registers handler for the messages published in the channel
+	Subscribe(channel string, handler func(message []byte)) error
+}
+
+// PubSubAdapter keeps rooms of the local sessions and publishes broadcasts
+// through a broker, so they reach the sessions connected to other nodes
+type PubSubAdapter struct {
+	*MemoryAdapter
+
+	node    string
+	channel string
+	broker  Broker
+}
+
+type envelope struct {
+	Node    string    `json:"node"`
+	Message Broadcast `json:"message"`
+}
+
+// NewPubSubAdapter creates adapter subscribed to the broker channel
+func NewPubSubAdapter(sender Sender, broker Broker, channel string) (*PubSubAdapter, error) {
+	adapter := &PubSubAdapter{
+		MemoryAdapter: NewMemoryAdapter(sender),
+
+		node:    utils.GenerateBase64ID(),
+		channel: channel,
+		broker:  broker,
+	}
+
+	err := broker.Subscribe(channel, adapter.receive)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return adapter, nil
+}
+
+// Broadcast sends the message to the local sessions and publishes it to the other nodes
+func (adapter *PubSubAdapter) Broadcast(message Broadcast) error {
+	adapter.MemoryAdapter.Broadcast(message)
+
+	encoded, err := json.Marshal(envelope{adapter.node, message})
+
+	if err != nil {
+		return err
+	}
+
+	return adapter.broker.Publish(adapter.channel, encoded)
+}
+
+func (adapter *PubSubAdapter) receive(data []byte) {
+	var received envelope
+
+	err := json.Unmarshal(data, &received)
+
+	if err != nil {
+		logger.Error("Invalid broadcast received: ", err)
+		return
+	}
+
+	if received.Node == adapter.node {
+		return
+	}
+
+	adapter.MemoryAdapter.Broadcast(received.Message)
+}
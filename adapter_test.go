@@ -0,0 +1,144 @@
+package eio_test
+
+import (
+	"sort"
+	"sync"
+	"testing"
+
+	eio "github.com/byonchev/go-engine.io"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingSender struct {
+	sync.Mutex
+
+	received []string
+}
+
+func (sender *recordingSender) Send(sessionID string, binary bool, data []byte) error {
+	sender.Lock()
+	defer sender.Unlock()
+
+	sender.received = append(sender.received, sessionID+":"+string(data))
+
+	return nil
+}
+
+func (sender *recordingSender) messages() []string {
+	sender.Lock()
+	defer sender.Unlock()
+
+	messages := append([]string{}, sender.received...)
+	sort.Strings(messages)
+
+	return messages
+}
+
+type fakeBroker struct {
+	sync.Mutex
+
+	handlers map[string][]func([]byte)
+}
+
+func (broker *fakeBroker) Publish(channel string, message []byte) error {
+	broker.Lock()
+	handlers := broker.handlers[channel]
+	broker.Unlock()
+
+	for _, handler := range handlers {
+		handler(message)
+	}
+
+	return nil
+}
+
+func (broker *fakeBroker) Subscribe(channel string, handler func([]byte)) error {
+	broker.Lock()
+	defer broker.Unlock()
+
+	if broker.handlers == nil {
+		broker.handlers = make(map[string][]func([]byte))
+	}
+
+	broker.handlers[channel] = append(broker.handlers[channel], handler)
+
+	return nil
+}
+
+func TestMemoryAdapterRooms(t *testing.T) {
+	adapter := eio.NewMemoryAdapter(&recordingSender{})
+
+	adapter.Join("a", "news")
+	adapter.Join("a", "sports")
+	adapter.Leave("a", "news")
+
+	rooms, err := adapter.Rooms("a")
+
+	assert.Nil(t, err, "rooms lookup failed")
+	assert.Equal(t, []string{"sports"}, rooms, "wrong rooms")
+}
+
+func TestMemoryAdapterBroadcast(t *testing.T) {
+	tests := []struct {
+		message  eio.Broadcast
+		expected []string
+	}{
+		{
+			eio.Broadcast{Data: []byte("all")},
+			[]string{"a:all", "b:all", "c:all"},
+		},
+		{
+			eio.Broadcast{Rooms: []string{"news"}, Data: []byte("news")},
+			[]string{"a:news", "b:news"},
+		},
+		{
+			eio.Broadcast{Rooms: []string{"news", "sports"}, Except: []string{"a"}, Data: []byte("except")},
+			[]string{"b:except", "c:except"},
+		},
+		{
+			eio.Broadcast{Rooms: []string{"unknown"}, Data: []byte("none")},
+			[]string{},
+		},
+	}
+
+	for _, test := range tests {
+		sender := &recordingSender{}
+		adapter := eio.NewMemoryAdapter(sender)
+
+		adapter.Join("a", "a")
+		adapter.Join("b", "b")
+		adapter.Join("c", "c")
+		adapter.Join("a", "news")
+		adapter.Join("b", "news")
+		adapter.Join("c", "sports")
+
+		err := adapter.Broadcast(test.message)
+
+		assert.Nil(t, err, "broadcast failed")
+		assert.Equal(t, test.expected, sender.messages(), "wrong broadcast recipients")
+	}
+}
+
+func TestPubSubAdapterBroadcast(t *testing.T) {
+	broker := &fakeBroker{}
+
+	firstSender := &recordingSender{}
+	first, err := eio.NewPubSubAdapter(firstSender, broker, "engine.io")
+
+	assert.Nil(t, err, "first adapter was not created")
+
+	secondSender := &recordingSender{}
+	second, err := eio.NewPubSubAdapter(secondSender, broker, "engine.io")
+
+	assert.Nil(t, err, "second adapter was not created")
+
+	first.Join("a", "news")
+	second.Join("b", "news")
+	second.Join("c", "sports")
+
+	err = first.Broadcast(eio.Broadcast{Rooms: []string{"news"}, Data: []byte("hello")})
+
+	assert.Nil(t, err, "broadcast failed")
+	assert.Equal(t, []string{"a:hello"}, firstSender.messages(), "local session did not receive broadcast once")
+	assert.Equal(t, []string{"b:hello"}, secondSender.messages(), "remote session did not receive broadcast")
+}
@@ -0,0 +1,34 @@
+package eio
+
+// BroadcastOperator selects the sessions receiving a broadcast.
+// Operators are immutable, so they can be reused for multiple broadcasts
+type BroadcastOperator struct {
+	adapter Adapter
+	rooms   []string
+	except  []string
+}
+
+// To returns operator which also targets the sessions in the rooms
+func (operator BroadcastOperator) To(rooms ...string) BroadcastOperator {
+	operator.rooms = append(operator.rooms[:len(operator.rooms):len(operator.rooms)], rooms...)
+
+	return operator
+}
+
+// Except returns operator which skips the sessions in the rooms
+func (operator BroadcastOperator) Except(rooms ...string) BroadcastOperator {
+	operator.except = append(operator.except[:len(operator.except):len(operator.except)], rooms...)
+
+	return operator
+}
+
+// Send sends message to the selected sessions.
+// All sessions are selected if no rooms are targeted
+func (operator BroadcastOperator) Send(binary bool, data []byte) error {
+	return operator.adapter.Broadcast(Broadcast{
+		Rooms:  operator.rooms,
+		Except: operator.except,
+		Binary: binary,
+		Data:   data,
+	})
+}
@@ -0,0 +1,88 @@
+package eio_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	eio "github.com/byonchev/go-engine.io"
+	"github.com/byonchev/go-engine.io/internal/codec"
+	"github.com/byonchev/go-engine.io/internal/packet"
+	"github.com/byonchev/go-engine.io/internal/protocol"
+	"github.com/byonchev/go-engine.io/internal/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerRooms(t *testing.T) {
+	server := eio.NewServer()
+	adapter := eio.NewMemoryAdapter(server)
+
+	server.SetAdapter(adapter)
+
+	endpoint := httptest.NewServer(server)
+	defer endpoint.Close()
+
+	first := handshake(t, endpoint.URL)
+	second := handshake(t, endpoint.URL)
+
+	assert.Nil(t, server.Join(first, "room"), "first session did not join")
+	assert.Nil(t, server.Join(second, "room"), "second session did not join")
+	assert.Error(t, server.Join("unknown", "room"), "unknown session joined")
+
+	server.To("room").Except(second).Send(false, []byte("broadcast"))
+	server.Send(second, false, []byte("direct"))
+
+	assert.Equal(t, "4broadcast", poll(t, endpoint.URL, first), "room member did not receive broadcast")
+	assert.Equal(t, "4direct", poll(t, endpoint.URL, second), "excluded session received broadcast")
+
+	server.Leave(first, "room")
+	server.To("room").Send(false, []byte("left"))
+	server.Send(first, false, []byte("direct"))
+
+	assert.Equal(t, "4direct", poll(t, endpoint.URL, first), "session received broadcast after leaving")
+
+	server.Close()
+
+	rooms, _ := adapter.Rooms(second)
+
+	assert.Empty(t, rooms, "rooms were not left on disconnect")
+}
+
+func handshake(t *testing.T, url string) string {
+	response, err := http.Get(url + "/?EIO=4&transport=polling")
+
+	assert.Nil(t, err, "handshake failed")
+
+	defer response.Body.Close()
+
+	payload, err := codec.XHR{Protocol: protocol.V4}.Decode(response.Body)
+
+	assert.Nil(t, err, "handshake was not decoded")
+
+	return sessionID(t, payload)
+}
+
+// sessionID returns the session ID sent in the open packet of the payload
+func sessionID(t *testing.T, payload packet.Payload) string {
+	if !assert.NotEmpty(t, payload, "open packet was not received") {
+		return ""
+	}
+
+	parsed, err := utils.ParseHandshakePacket(payload[0])
+
+	assert.Nil(t, err, "handshake was not parsed")
+
+	return parsed.SessionID
+}
+
+func poll(t *testing.T, url string, sessionID string) string {
+	response, err := http.Get(url + "/?EIO=4&transport=polling&sid=" + sessionID)
+
+	assert.Nil(t, err, "poll failed")
+
+	body, _ := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+
+	return string(body)
+}
@@ -0,0 +1,835 @@
+package client
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/byonchev/go-engine.io/event"
+	"github.com/byonchev/go-engine.io/internal/codec"
+	"github.com/byonchev/go-engine.io/internal/dispatch"
+	"github.com/byonchev/go-engine.io/internal/logger"
+	"github.com/byonchev/go-engine.io/internal/packet"
+	"github.com/byonchev/go-engine.io/internal/protocol"
+	"github.com/byonchev/go-engine.io/internal/utils"
+)
+
+// eventQueueSize limits the events waiting for the client handlers
+const eventQueueSize = 100
+
+// Client is a connection to an engine.io server.
+// Handlers are called one at a time, in the order the connection events occurred
+type Client struct {
+	config   Config
+	url      *url.URL
+	protocol protocol.Version
+
+	sync.RWMutex
+
+	sessionID string
+	handshake utils.Handshake
+	transport transport
+	connected bool
+	closed    bool
+	done      chan struct{}
+
+	// closed by the polling loop when it stops for transport upgrade
+	pollingPaused chan struct{}
+	pollingActive bool
+
+	// packets sent while reconnecting, delivered after the next session opens
+	sendLock     sync.Mutex
+	reconnecting bool
+	buffer       packet.Payload
+
+	heartbeatLock sync.Mutex
+	pingTimer     *time.Timer
+	timeoutTimer  *time.Timer
+
+	events *dispatch.Queue
+
+	handlersLock    sync.RWMutex
+	openHandlers    []func()
+	messageHandlers []func(bool, []byte)
+	closeHandlers   []func(string)
+	upgradeHandlers []func(string)
+	errorHandlers   []func(error)
+
+	reconnectAttemptHandlers []func(int, time.Duration)
+	reconnectHandlers        []func(int)
+	reconnectFailedHandlers  []func(int)
+
+	eventsOnce    sync.Once
+	eventsChannel chan interface{}
+	eventsClosed  bool
+}
+
+// NewClient creates client for the engine.io endpoint URL.
+// Handlers should be registered before calling Connect
+func NewClient(endpoint string, config Config) (*Client, error) {
+	parsed, err := url.Parse(endpoint)
+
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := protocol.Parse(strconv.Itoa(config.Protocol))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if config.HTTPClient == nil {
+		config.HTTPClient = DefaultConfig().HTTPClient
+	}
+
+	if config.Transport == "" {
+		config.Transport = PollingTransport
+	}
+
+	if config.ReconnectDelay <= 0 {
+		config.ReconnectDelay = DefaultConfig().ReconnectDelay
+	}
+
+	if config.ReconnectFactor < 1 {
+		config.ReconnectFactor = 1
+	}
+
+	client := &Client{
+		config:   config,
+		url:      parsed,
+		protocol: version,
+
+		done:   make(chan struct{}),
+		events: dispatch.NewQueue(eventQueueSize, dispatch.Block),
+	}
+
+	return client, nil
+}
+
+// Connect performs the handshake and starts receiving packets
+func (client *Client) Connect() error {
+	return client.open()
+}
+
+// ID returns the ID of the current session
+func (client *Client) ID() string {
+	client.RLock()
+	defer client.RUnlock()
+
+	return client.sessionID
+}
+
+// Transport returns the type of the active transport
+func (client *Client) Transport() string {
+	client.RLock()
+	defer client.RUnlock()
+
+	if client.transport == nil {
+		return ""
+	}
+
+	return client.transport.Type()
+}
+
+// Send sends message to the server. While reconnecting, messages are buffered
+// and sent after the new session opens
+func (client *Client) Send(binary bool, data []byte) error {
+	return client.send(packet.NewMessage(binary, data), true)
+}
+
+// Close sends close packet to the server and stops reconnecting
+func (client *Client) Close() error {
+	client.Lock()
+
+	if client.closed {
+		client.Unlock()
+
+		return errors.New("client already closed")
+	}
+
+	client.closed = true
+	close(client.done)
+
+	connected := client.connected
+
+	client.Unlock()
+
+	if !connected {
+		return nil
+	}
+
+	err := client.send(packet.NewClose(), false)
+
+	client.disconnect("forced close", false)
+
+	return err
+}
+
+// OnOpen registers handler for established sessions
+func (client *Client) OnOpen(handler func()) {
+	client.handlersLock.Lock()
+	defer client.handlersLock.Unlock()
+
+	client.openHandlers = append(client.openHandlers, handler)
+}
+
+// OnMessage registers handler for messages received from the server
+func (client *Client) OnMessage(handler func(binary bool, data []byte)) {
+	client.handlersLock.Lock()
+	defer client.handlersLock.Unlock()
+
+	client.messageHandlers = append(client.messageHandlers, handler)
+}
+
+// OnClose registers handler for lost or closed sessions
+func (client *Client) OnClose(handler func(reason string)) {
+	client.handlersLock.Lock()
+	defer client.handlersLock.Unlock()
+
+	client.closeHandlers = append(client.closeHandlers, handler)
+}
+
+// OnUpgrade registers handler for completed transport upgrades
+func (client *Client) OnUpgrade(handler func(transport string)) {
+	client.handlersLock.Lock()
+	defer client.handlersLock.Unlock()
+
+	client.upgradeHandlers = append(client.upgradeHandlers, handler)
+}
+
+// OnError registers handler for connection errors
+func (client *Client) OnError(handler func(err error)) {
+	client.handlersLock.Lock()
+	defer client.handlersLock.Unlock()
+
+	client.errorHandlers = append(client.errorHandlers, handler)
+}
+
+// OnReconnectAttempt registers handler called before each reconnect attempt
+func (client *Client) OnReconnectAttempt(handler func(attempt int, delay time.Duration)) {
+	client.handlersLock.Lock()
+	defer client.handlersLock.Unlock()
+
+	client.reconnectAttemptHandlers = append(client.reconnectAttemptHandlers, handler)
+}
+
+// OnReconnect registers handler for sessions opened by reconnecting
+func (client *Client) OnReconnect(handler func(attempts int)) {
+	client.handlersLock.Lock()
+	defer client.handlersLock.Unlock()
+
+	client.reconnectHandlers = append(client.reconnectHandlers, handler)
+}
+
+// OnReconnectFailed registers handler called when the reconnect attempts are exhausted
+func (client *Client) OnReconnectFailed(handler func(attempts int)) {
+	client.handlersLock.Lock()
+	defer client.handlersLock.Unlock()
+
+	client.reconnectFailedHandlers = append(client.reconnectFailedHandlers, handler)
+}
+
+// Events returns channel with the server events types emitted by the client.
+// The channel should be read until it is closed after the client stops
+func (client *Client) Events() <-chan interface{} {
+	client.eventsOnce.Do(func() {
+		client.handlersLock.Lock()
+		defer client.handlersLock.Unlock()
+
+		client.eventsChannel = make(chan interface{})
+
+		if client.eventsClosed {
+			close(client.eventsChannel)
+		}
+	})
+
+	return client.eventsChannel
+}
+
+func (client *Client) open() error {
+	transport, handshake, pending, err := client.handshakeTransport()
+
+	if err != nil {
+		return err
+	}
+
+	client.sendLock.Lock()
+	client.Lock()
+
+	if client.closed {
+		client.Unlock()
+		client.sendLock.Unlock()
+
+		transport.Close()
+
+		return errors.New("client closed")
+	}
+
+	client.sessionID = handshake.SessionID
+	client.handshake = handshake
+	client.transport = transport
+	client.connected = true
+	client.pollingActive = transport.Type() == PollingTransport
+
+	client.Unlock()
+
+	client.emit(event.Connect{SessionID: handshake.SessionID})
+
+	client.flushBuffer(transport)
+	client.sendLock.Unlock()
+
+	client.startHeartbeat()
+
+	for _, received := range pending {
+		client.handlePacket(received)
+	}
+
+	go client.receive(transport)
+
+	if client.shouldUpgrade(transport, handshake) {
+		go client.upgrade(transport)
+	}
+
+	return nil
+}
+
+// handshakeTransport opens session on the configured transport and returns
+// the packets received after the open packet
+func (client *Client) handshakeTransport() (transport, utils.Handshake, packet.Payload, error) {
+	var transport transport
+	var err error
+
+	if client.config.Transport == WebsocketTransport {
+		transport, err = dialWebsocket(client.config.HTTPClient, client.endpoint(WebsocketTransport, ""), client.config.Header, client.protocol)
+	} else {
+		transport = newPolling(client.config.HTTPClient, client.endpoint(PollingTransport, ""), client.config.Header, client.protocol)
+	}
+
+	if err != nil {
+		return nil, utils.Handshake{}, nil, err
+	}
+
+	payload, err := transport.Receive()
+
+	if err == nil && len(payload) == 0 {
+		err = errors.New("empty handshake payload")
+	}
+
+	if err != nil {
+		transport.Close()
+
+		return nil, utils.Handshake{}, nil, err
+	}
+
+	handshake, err := utils.ParseHandshakePacket(payload[0])
+
+	if err != nil {
+		transport.Close()
+
+		return nil, utils.Handshake{}, nil, err
+	}
+
+	if polling, ok := transport.(*polling); ok {
+		polling.url = client.endpoint(PollingTransport, handshake.SessionID)
+	}
+
+	return transport, handshake, payload[1:], nil
+}
+
+func (client *Client) shouldUpgrade(transport transport, handshake utils.Handshake) bool {
+	if !client.config.Upgrade || transport.Type() != PollingTransport {
+		return false
+	}
+
+	return utils.StringSliceContains(handshake.Upgrades, WebsocketTransport)
+}
+
+// upgrade probes websocket connection and switches to it after the polling loop pauses
+func (client *Client) upgrade(polling transport) {
+	sessionID := client.ID()
+
+	upgrade, err := dialWebsocket(client.config.HTTPClient, client.endpoint(WebsocketTransport, sessionID), client.config.Header, client.protocol)
+
+	if err != nil {
+		logger.Error("Websocket upgrade failed: ", err)
+		return
+	}
+
+	paused := client.pausePolling()
+
+	err = client.probe(upgrade, paused)
+
+	if err != nil {
+		logger.Error("Websocket probe failed: ", err)
+
+		upgrade.Close()
+		client.resumePolling(polling)
+
+		return
+	}
+
+	client.sendLock.Lock()
+
+	err = upgrade.Send(packet.Payload{packet.NewUpgrade()})
+
+	if err == nil {
+		client.Lock()
+		client.transport = upgrade
+		client.Unlock()
+	}
+
+	client.sendLock.Unlock()
+
+	if err != nil {
+		logger.Error("Websocket upgrade failed: ", err)
+
+		upgrade.Close()
+		client.resumePolling(polling)
+
+		return
+	}
+
+	polling.Close()
+
+	go client.receive(upgrade)
+
+	client.emit(event.Upgrade{SessionID: sessionID, Transport: WebsocketTransport})
+}
+
+// probe exchanges the probe packets and waits for the polling loop to pause
+func (client *Client) probe(upgrade transport, paused <-chan struct{}) error {
+	err := upgrade.Send(packet.Payload{packet.NewPing([]byte("probe"))})
+
+	if err != nil {
+		return err
+	}
+
+	payload, err := upgrade.Receive()
+
+	if err != nil {
+		return err
+	}
+
+	if len(payload) != 1 || payload[0].Type != packet.Pong || string(payload[0].Data) != "probe" {
+		return errors.New("invalid probe response")
+	}
+
+	select {
+	case <-paused:
+		return nil
+	case <-client.done:
+		return errors.New("client closed")
+	case <-time.After(client.pingTimeout()):
+		return errors.New("polling was not paused")
+	}
+}
+
+func (client *Client) pausePolling() <-chan struct{} {
+	client.Lock()
+	defer client.Unlock()
+
+	client.pollingPaused = make(chan struct{})
+
+	return client.pollingPaused
+}
+
+func (client *Client) resumePolling(polling transport) {
+	client.Lock()
+	defer client.Unlock()
+
+	client.pollingPaused = nil
+
+	if client.connected && client.transport == polling && !client.pollingActive {
+		client.pollingActive = true
+
+		go client.receive(polling)
+	}
+}
+
+func (client *Client) receive(transport transport) {
+	for {
+		payload, err := transport.Receive()
+
+		if err != nil {
+			if client.isActive(transport) {
+				logger.Error("Receive error: ", err)
+
+				client.disconnect(disconnectReason(err), true)
+			}
+
+			return
+		}
+
+		for _, received := range payload {
+			client.handlePacket(received)
+		}
+
+		if !client.continueReceiving(transport) {
+			return
+		}
+	}
+}
+
+// disconnectReason describes the receive error which closed the connection
+func disconnectReason(err error) string {
+	var decodeError *codec.DecodeError
+
+	if errors.As(err, &decodeError) {
+		return "parse error"
+	}
+
+	return "transport error"
+}
+
+// continueReceiving returns false if the transport was replaced
+// or the polling loop should pause for transport upgrade
+func (client *Client) continueReceiving(transport transport) bool {
+	client.Lock()
+	defer client.Unlock()
+
+	if client.transport != transport || !client.connected {
+		return false
+	}
+
+	if transport.Type() == PollingTransport && client.pollingPaused != nil {
+		client.pollingActive = false
+
+		close(client.pollingPaused)
+
+		return false
+	}
+
+	return true
+}
+
+func (client *Client) isActive(transport transport) bool {
+	client.RLock()
+	defer client.RUnlock()
+
+	return client.connected && client.transport == transport
+}
+
+func (client *Client) handlePacket(received packet.Packet) {
+	switch received.Type {
+	case packet.Ping:
+		client.handlePing(received)
+	case packet.Pong:
+		client.handlePong(received)
+	case packet.Close:
+		client.disconnect("server close", false)
+	case packet.Message:
+		client.handleMessage(received)
+	}
+}
+
+func (client *Client) handlePing(ping packet.Packet) {
+	if client.protocol != protocol.V4 {
+		return
+	}
+
+	client.resetTimeout(client.pingInterval() + client.pingTimeout())
+
+	err := client.send(packet.NewPong(ping.Data), false)
+
+	if err != nil {
+		client.emitError(err)
+	}
+}
+
+func (client *Client) handlePong(pong packet.Packet) {
+	if client.protocol != protocol.V3 {
+		return
+	}
+
+	client.heartbeatLock.Lock()
+	defer client.heartbeatLock.Unlock()
+
+	if client.timeoutTimer != nil {
+		client.timeoutTimer.Stop()
+	}
+
+	if client.pingTimer != nil {
+		client.pingTimer.Reset(client.pingInterval())
+	}
+}
+
+func (client *Client) handleMessage(message packet.Packet) {
+	received := event.Message{
+		SessionID: client.ID(),
+		Binary:    message.Binary,
+		Data:      message.Data,
+	}
+
+	client.events.Push(func() {
+		client.handle(received)
+	})
+}
+
+// startHeartbeat arms the heartbeat timers. Protocol v3 clients send pings and expect
+// pong within the ping timeout. Protocol v4 clients expect server pings
+func (client *Client) startHeartbeat() {
+	client.heartbeatLock.Lock()
+	defer client.heartbeatLock.Unlock()
+
+	if client.protocol == protocol.V3 {
+		client.pingTimer = time.AfterFunc(client.pingInterval(), client.sendPing)
+		client.timeoutTimer = time.AfterFunc(client.pingInterval()+client.pingTimeout(), client.expire)
+		client.timeoutTimer.Stop()
+	} else {
+		client.timeoutTimer = time.AfterFunc(client.pingInterval()+client.pingTimeout(), client.expire)
+	}
+}
+
+func (client *Client) stopHeartbeat() {
+	client.heartbeatLock.Lock()
+	defer client.heartbeatLock.Unlock()
+
+	if client.pingTimer != nil {
+		client.pingTimer.Stop()
+	}
+
+	if client.timeoutTimer != nil {
+		client.timeoutTimer.Stop()
+	}
+}
+
+func (client *Client) sendPing() {
+	client.resetTimeout(client.pingTimeout())
+
+	err := client.send(packet.NewPing(nil), false)
+
+	if err != nil {
+		client.emitError(err)
+	}
+}
+
+func (client *Client) resetTimeout(timeout time.Duration) {
+	client.heartbeatLock.Lock()
+	defer client.heartbeatLock.Unlock()
+
+	if client.timeoutTimer != nil {
+		client.timeoutTimer.Reset(timeout)
+	}
+}
+
+func (client *Client) expire() {
+	client.disconnect("ping timeout", true)
+}
+
+func (client *Client) pingInterval() time.Duration {
+	client.RLock()
+	defer client.RUnlock()
+
+	return time.Duration(client.handshake.PingInterval) * time.Millisecond
+}
+
+func (client *Client) pingTimeout() time.Duration {
+	client.RLock()
+	defer client.RUnlock()
+
+	return time.Duration(client.handshake.PingTimeout) * time.Millisecond
+}
+
+// send writes packet to the active transport. Buffered packets are queued while reconnecting
+func (client *Client) send(message packet.Packet, buffered bool) error {
+	client.sendLock.Lock()
+	defer client.sendLock.Unlock()
+
+	if buffered && client.reconnecting {
+		return client.bufferPacket(message)
+	}
+
+	client.RLock()
+	transport := client.transport
+	connected := client.connected
+	client.RUnlock()
+
+	if !connected {
+		return errors.New("client not connected")
+	}
+
+	return transport.Send(packet.Payload{message})
+}
+
+// disconnect closes the session transport and reconnects if the connection was lost
+func (client *Client) disconnect(reason string, reconnect bool) {
+	client.sendLock.Lock()
+	client.Lock()
+
+	if !client.connected {
+		client.Unlock()
+		client.sendLock.Unlock()
+		return
+	}
+
+	client.connected = false
+
+	transport := client.transport
+	sessionID := client.sessionID
+	reconnect = reconnect && !client.closed && client.config.Reconnect
+
+	client.pollingPaused = nil
+	client.pollingActive = false
+	client.reconnecting = reconnect
+
+	client.Unlock()
+	client.sendLock.Unlock()
+
+	client.stopHeartbeat()
+
+	transport.Close()
+
+	client.emit(event.Disconnect{SessionID: sessionID, Reason: reason})
+
+	if reconnect {
+		go client.reconnect()
+
+		return
+	}
+
+	client.finish()
+}
+
+// bufferPacket queues the packet until the next session opens
+func (client *Client) bufferPacket(message packet.Packet) error {
+	if client.config.ReconnectBufferSize > 0 && len(client.buffer) >= client.config.ReconnectBufferSize {
+		return errors.New("reconnect buffer is full")
+	}
+
+	client.buffer = append(client.buffer, message)
+
+	return nil
+}
+
+// flushBuffer sends the packets buffered while reconnecting before any other packet
+func (client *Client) flushBuffer(transport transport) {
+	buffered := client.buffer
+
+	client.buffer = nil
+	client.reconnecting = false
+
+	if len(buffered) == 0 {
+		return
+	}
+
+	err := transport.Send(buffered)
+
+	if err != nil {
+		logger.Error("Error sending buffered packets: ", err)
+
+		client.emitError(err)
+	}
+}
+
+// finish drops the buffered packets and closes the events channel
+// after all queued events are handled
+func (client *Client) finish() {
+	client.sendLock.Lock()
+	client.reconnecting = false
+	client.buffer = nil
+	client.sendLock.Unlock()
+
+	client.events.Force(func() {
+		client.handlersLock.Lock()
+		defer client.handlersLock.Unlock()
+
+		client.eventsClosed = true
+
+		if client.eventsChannel != nil {
+			close(client.eventsChannel)
+		}
+	})
+
+	client.events.Close()
+}
+
+func (client *Client) endpoint(transport string, sessionID string) string {
+	endpoint := *client.url
+
+	query := endpoint.Query()
+	query.Set("EIO", strconv.Itoa(int(client.protocol)))
+	query.Set("transport", transport)
+
+	if sessionID != "" {
+		query.Set("sid", sessionID)
+	}
+
+	endpoint.RawQuery = query.Encode()
+
+	if transport == WebsocketTransport {
+		switch endpoint.Scheme {
+		case "http":
+			endpoint.Scheme = "ws"
+		case "https":
+			endpoint.Scheme = "wss"
+		}
+	}
+
+	return endpoint.String()
+}
+
+func (client *Client) emit(emitted interface{}) {
+	client.events.Force(func() {
+		client.handle(emitted)
+	})
+}
+
+func (client *Client) emitError(err error) {
+	client.emit(event.Error{SessionID: client.ID(), Error: err})
+}
+
+func (client *Client) handle(emitted interface{}) {
+	client.handlersLock.RLock()
+	openHandlers := client.openHandlers
+	messageHandlers := client.messageHandlers
+	closeHandlers := client.closeHandlers
+	upgradeHandlers := client.upgradeHandlers
+	errorHandlers := client.errorHandlers
+	reconnectAttemptHandlers := client.reconnectAttemptHandlers
+	reconnectHandlers := client.reconnectHandlers
+	reconnectFailedHandlers := client.reconnectFailedHandlers
+	channel := client.eventsChannel
+	client.handlersLock.RUnlock()
+
+	switch emitted := emitted.(type) {
+	case event.Connect:
+		for _, handler := range openHandlers {
+			handler()
+		}
+	case event.Message:
+		for _, handler := range messageHandlers {
+			handler(emitted.Binary, emitted.Data)
+		}
+	case event.Disconnect:
+		for _, handler := range closeHandlers {
+			handler(emitted.Reason)
+		}
+	case event.Upgrade:
+		for _, handler := range upgradeHandlers {
+			handler(emitted.Transport)
+		}
+	case event.Error:
+		for _, handler := range errorHandlers {
+			handler(emitted.Error)
+		}
+	case ReconnectAttemptEvent:
+		for _, handler := range reconnectAttemptHandlers {
+			handler(emitted.Attempt, emitted.Delay)
+		}
+	case ReconnectEvent:
+		for _, handler := range reconnectHandlers {
+			handler(emitted.Attempts)
+		}
+	case ReconnectFailedEvent:
+		for _, handler := range reconnectFailedHandlers {
+			handler(emitted.Attempts)
+		}
+	}
+
+	if channel != nil {
+		channel <- emitted
+	}
+}
@@ -0,0 +1,519 @@
+package client_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	eio "github.com/byonchev/go-engine.io"
+	"github.com/byonchev/go-engine.io/client"
+	"github.com/stretchr/testify/assert"
+)
+
+func startEchoServer(setup func(*eio.Server)) (*eio.Server, *httptest.Server) {
+	server := eio.NewServer()
+
+	if setup != nil {
+		setup(server)
+	}
+
+	server.OnConnection(func(socket *eio.Socket) {
+		socket.OnMessage(func(binary bool, data []byte) {
+			socket.Send(binary, data)
+		})
+	})
+
+	return server, httptest.NewServer(server)
+}
+
+func connect(t *testing.T, url string, config client.Config) (*client.Client, <-chan string) {
+	instance, err := client.NewClient(url, config)
+
+	assert.Nil(t, err, "client was not created")
+
+	messages := make(chan string, 10)
+
+	instance.OnMessage(func(binary bool, data []byte) {
+		messages <- string(data)
+	})
+
+	err = instance.Connect()
+
+	assert.Nil(t, err, "client did not connect")
+
+	return instance, messages
+}
+
+func receive(t *testing.T, messages <-chan string) string {
+	select {
+	case message := <-messages:
+		return message
+	case <-time.After(time.Second):
+		assert.Fail(t, "message was not received")
+		return ""
+	}
+}
+
+func TestClientPolling(t *testing.T) {
+	for _, version := range []int{3, 4} {
+		server, endpoint := startEchoServer(nil)
+
+		config := client.DefaultConfig()
+		config.Protocol = version
+		config.Upgrade = false
+
+		instance, messages := connect(t, endpoint.URL, config)
+
+		assert.NotEmpty(t, instance.ID(), "session ID was not set")
+		assert.Equal(t, client.PollingTransport, instance.Transport(), "wrong transport")
+
+		instance.Send(false, []byte("hello"))
+		instance.Send(true, []byte{1, 2, 3})
+
+		assert.Equal(t, "hello", receive(t, messages), "string message was not echoed")
+		assert.Equal(t, string([]byte{1, 2, 3}), receive(t, messages), "binary message was not echoed")
+
+		instance.Close()
+		server.Close()
+		endpoint.Close()
+	}
+}
+
+func TestClientWebsocket(t *testing.T) {
+	for _, version := range []int{3, 4} {
+		server, endpoint := startEchoServer(nil)
+
+		config := client.DefaultConfig()
+		config.Protocol = version
+		config.Transport = client.WebsocketTransport
+
+		instance, messages := connect(t, endpoint.URL, config)
+
+		assert.Equal(t, client.WebsocketTransport, instance.Transport(), "wrong transport")
+
+		instance.Send(false, []byte("hello"))
+		instance.Send(true, []byte{1, 2, 3})
+
+		assert.Equal(t, "hello", receive(t, messages), "string message was not echoed")
+		assert.Equal(t, string([]byte{1, 2, 3}), receive(t, messages), "binary message was not echoed")
+
+		instance.Close()
+		server.Close()
+		endpoint.Close()
+	}
+}
+
+func TestClientWebsocketTLS(t *testing.T) {
+	server := eio.NewServer()
+	defer server.Close()
+
+	endpoint := httptest.NewTLSServer(server)
+	defer endpoint.Close()
+
+	config := client.DefaultConfig()
+	config.Transport = client.WebsocketTransport
+	config.HTTPClient = endpoint.Client()
+
+	instance, _ := connect(t, endpoint.URL, config)
+
+	assert.Equal(t, client.WebsocketTransport, instance.Transport(), "websocket did not use the client TLS settings")
+
+	instance.Close()
+}
+
+func TestClientUpgrade(t *testing.T) {
+	server, endpoint := startEchoServer(nil)
+	defer endpoint.Close()
+	defer server.Close()
+
+	instance, err := client.NewClient(endpoint.URL, client.DefaultConfig())
+
+	assert.Nil(t, err, "client was not created")
+
+	upgrades := make(chan string, 1)
+	messages := make(chan string, 1)
+
+	instance.OnUpgrade(func(transport string) {
+		upgrades <- transport
+	})
+
+	instance.OnMessage(func(binary bool, data []byte) {
+		messages <- string(data)
+	})
+
+	instance.Connect()
+	defer instance.Close()
+
+	select {
+	case transport := <-upgrades:
+		assert.Equal(t, client.WebsocketTransport, transport, "wrong upgrade transport")
+	case <-time.After(time.Second):
+		assert.Fail(t, "transport was not upgraded")
+	}
+
+	assert.Equal(t, client.WebsocketTransport, instance.Transport(), "wrong transport after upgrade")
+
+	instance.Send(false, []byte("upgraded"))
+
+	assert.Equal(t, "upgraded", receive(t, messages), "message was not echoed after upgrade")
+}
+
+func TestClientHeartbeat(t *testing.T) {
+	for _, version := range []int{3, 4} {
+		closed := make(chan string, 1)
+
+		server, endpoint := startEchoServer(func(server *eio.Server) {
+			server.PingInterval = 20 * time.Millisecond
+			server.PingTimeout = 50 * time.Millisecond
+
+			server.OnConnection(func(socket *eio.Socket) {
+				socket.OnClose(func(reason string) {
+					closed <- reason
+				})
+			})
+		})
+
+		config := client.DefaultConfig()
+		config.Protocol = version
+		config.Upgrade = false
+
+		instance, _ := connect(t, endpoint.URL, config)
+
+		select {
+		case reason := <-closed:
+			assert.Fail(t, "session closed during heartbeat: "+reason)
+		case <-time.After(300 * time.Millisecond):
+		}
+
+		instance.Close()
+		server.Close()
+		endpoint.Close()
+	}
+}
+
+func TestClientReconnect(t *testing.T) {
+	sockets := make(chan *eio.Socket, 2)
+
+	server, endpoint := startEchoServer(func(server *eio.Server) {
+		server.OnConnection(func(socket *eio.Socket) {
+			sockets <- socket
+		})
+	})
+
+	defer endpoint.Close()
+	defer server.Close()
+
+	config := client.DefaultConfig()
+	config.Upgrade = false
+	config.ReconnectDelay = 10 * time.Millisecond
+
+	instance, err := client.NewClient(endpoint.URL, config)
+
+	assert.Nil(t, err, "client was not created")
+
+	opened := make(chan string, 2)
+	closed := make(chan string, 2)
+
+	instance.OnOpen(func() {
+		opened <- instance.ID()
+	})
+
+	instance.OnClose(func(reason string) {
+		closed <- reason
+	})
+
+	instance.Connect()
+	defer instance.Close()
+
+	first := <-opened
+
+	(<-sockets).Close()
+
+	assert.Equal(t, "transport error", <-closed, "wrong disconnect reason")
+
+	select {
+	case second := <-opened:
+		assert.NotEqual(t, first, second, "session was not recreated")
+	case <-time.After(time.Second):
+		assert.Fail(t, "client did not reconnect")
+	}
+}
+
+func TestClientClose(t *testing.T) {
+	closed := make(chan string, 1)
+
+	server, endpoint := startEchoServer(func(server *eio.Server) {
+		server.OnConnection(func(socket *eio.Socket) {
+			socket.OnClose(func(reason string) {
+				closed <- reason
+			})
+		})
+	})
+
+	defer endpoint.Close()
+	defer server.Close()
+
+	config := client.DefaultConfig()
+	config.Upgrade = false
+
+	instance, err := client.NewClient(endpoint.URL, config)
+
+	assert.Nil(t, err, "client was not created")
+
+	events := instance.Events()
+
+	instance.Connect()
+
+	assert.IsType(t, eio.ConnectEvent{}, <-events, "connect event was not emitted")
+
+	instance.Close()
+
+	assert.Equal(t, eio.DisconnectEvent{SessionID: instance.ID(), Reason: "forced close"}, <-events, "disconnect event was not emitted")
+
+	_, open := <-events
+
+	assert.False(t, open, "events channel was not closed")
+
+	select {
+	case reason := <-closed:
+		assert.Equal(t, "close packet received", reason, "wrong server close reason")
+	case <-time.After(time.Second):
+		assert.Fail(t, "server session was not closed")
+	}
+}
+
+func TestClientReconnectBuffer(t *testing.T) {
+	sockets := make(chan *eio.Socket, 2)
+
+	server, endpoint := startEchoServer(func(server *eio.Server) {
+		server.OnConnection(func(socket *eio.Socket) {
+			sockets <- socket
+		})
+	})
+
+	defer endpoint.Close()
+	defer server.Close()
+
+	config := client.DefaultConfig()
+	config.Upgrade = false
+	config.ReconnectDelay = 10 * time.Millisecond
+
+	instance, err := client.NewClient(endpoint.URL, config)
+
+	assert.Nil(t, err, "client was not created")
+
+	closed := make(chan string, 1)
+	reconnected := make(chan int, 1)
+	messages := make(chan string, 2)
+
+	instance.OnClose(func(reason string) {
+		closed <- reason
+	})
+
+	instance.OnReconnect(func(attempts int) {
+		reconnected <- attempts
+	})
+
+	instance.OnMessage(func(binary bool, data []byte) {
+		messages <- string(data)
+	})
+
+	instance.Connect()
+	defer instance.Close()
+
+	(<-sockets).Close()
+	<-closed
+
+	err = instance.Send(false, []byte("first"))
+
+	assert.Nil(t, err, "message was not buffered")
+
+	instance.Send(false, []byte("second"))
+
+	select {
+	case attempts := <-reconnected:
+		assert.Equal(t, 1, attempts, "wrong reconnect attempts")
+	case <-time.After(time.Second):
+		assert.Fail(t, "client did not reconnect")
+	}
+
+	assert.Equal(t, "first", receive(t, messages), "buffered message was not delivered")
+	assert.Equal(t, "second", receive(t, messages), "buffered messages were reordered")
+}
+
+func TestClientReconnectFailed(t *testing.T) {
+	var failing int32
+
+	server := eio.NewServer()
+	defer server.Close()
+
+	sockets := make(chan *eio.Socket, 1)
+
+	server.OnConnection(func(socket *eio.Socket) {
+		sockets <- socket
+	})
+
+	endpoint := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if atomic.LoadInt32(&failing) == 1 {
+			writer.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		server.ServeHTTP(writer, request)
+	}))
+
+	defer endpoint.Close()
+
+	config := client.DefaultConfig()
+	config.Upgrade = false
+	config.ReconnectDelay = 5 * time.Millisecond
+	config.ReconnectDelayMax = 10 * time.Millisecond
+	config.ReconnectJitter = 0
+	config.ReconnectAttempts = 3
+
+	instance, err := client.NewClient(endpoint.URL, config)
+
+	assert.Nil(t, err, "client was not created")
+
+	var delays []time.Duration
+
+	instance.OnReconnectAttempt(func(attempt int, delay time.Duration) {
+		delays = append(delays, delay)
+	})
+
+	events := instance.Events()
+
+	instance.Connect()
+
+	atomic.StoreInt32(&failing, 1)
+
+	(<-sockets).Close()
+
+	var failed []client.ReconnectFailedEvent
+
+	for event := range events {
+		if event, ok := event.(client.ReconnectFailedEvent); ok {
+			failed = append(failed, event)
+		}
+	}
+
+	expected := []time.Duration{5 * time.Millisecond, 10 * time.Millisecond, 10 * time.Millisecond}
+
+	assert.Equal(t, expected, delays, "wrong reconnect delays")
+	assert.Equal(t, []client.ReconnectFailedEvent{{Attempts: 3}}, failed, "reconnect failure was not emitted")
+	assert.Error(t, instance.Send(false, []byte("lost")), "message was buffered after reconnect failed")
+}
+
+func TestClientReconnectDefaultDelay(t *testing.T) {
+	var failing int32
+
+	server := eio.NewServer()
+	defer server.Close()
+
+	sockets := make(chan *eio.Socket, 1)
+
+	server.OnConnection(func(socket *eio.Socket) {
+		sockets <- socket
+	})
+
+	endpoint := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if atomic.LoadInt32(&failing) == 1 {
+			writer.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		server.ServeHTTP(writer, request)
+	}))
+
+	defer endpoint.Close()
+
+	config := client.DefaultConfig()
+	config.Upgrade = false
+	config.ReconnectDelay = 0
+	config.ReconnectJitter = 0
+
+	instance, err := client.NewClient(endpoint.URL, config)
+
+	assert.Nil(t, err, "client was not created")
+
+	delays := make(chan time.Duration, 1)
+
+	instance.OnReconnectAttempt(func(attempt int, delay time.Duration) {
+		delays <- delay
+	})
+
+	instance.Connect()
+
+	atomic.StoreInt32(&failing, 1)
+
+	(<-sockets).Close()
+
+	select {
+	case delay := <-delays:
+		assert.Equal(t, client.DefaultConfig().ReconnectDelay, delay, "zero reconnect delay was not defaulted")
+	case <-time.After(time.Second):
+		assert.Fail(t, "client did not reconnect")
+	}
+
+	instance.Close()
+}
+
+func TestClientReconnectDelayLimit(t *testing.T) {
+	var failing int32
+
+	server := eio.NewServer()
+	defer server.Close()
+
+	sockets := make(chan *eio.Socket, 1)
+
+	server.OnConnection(func(socket *eio.Socket) {
+		sockets <- socket
+	})
+
+	endpoint := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if atomic.LoadInt32(&failing) == 1 {
+			writer.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		server.ServeHTTP(writer, request)
+	}))
+
+	defer endpoint.Close()
+
+	config := client.DefaultConfig()
+	config.Upgrade = false
+	config.ReconnectDelay = time.Millisecond
+	config.ReconnectDelayMax = 0
+	config.ReconnectFactor = 1e30
+	config.ReconnectAttempts = 0
+
+	instance, err := client.NewClient(endpoint.URL, config)
+
+	assert.Nil(t, err, "client was not created")
+
+	delays := make(chan time.Duration, 2)
+
+	instance.OnReconnectAttempt(func(attempt int, delay time.Duration) {
+		delays <- delay
+	})
+
+	instance.Connect()
+
+	atomic.StoreInt32(&failing, 1)
+
+	(<-sockets).Close()
+
+	<-delays
+
+	select {
+	case delay := <-delays:
+		assert.True(t, delay > 0 && delay <= 24*time.Hour, "reconnect delay was not limited")
+	case <-time.After(time.Second):
+		assert.Fail(t, "client did not retry")
+	}
+
+	instance.Close()
+}
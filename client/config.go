@@ -0,0 +1,70 @@
+package client
+
+import (
+	"net/http"
+	"time"
+)
+
+// Transport identifiers
+const (
+	PollingTransport   = "polling"
+	WebsocketTransport = "websocket"
+)
+
+// Config holds the client connection settings
+type Config struct {
+	// Engine.IO protocol version. Supported versions are 3 and 4
+	Protocol int
+
+	// Transport used for the handshake
+	Transport string
+
+	// Whether to upgrade to websocket when the server allows it
+	Upgrade bool
+
+	// Headers sent with every HTTP request and websocket handshake
+	Header http.Header
+
+	// Client for polling requests. Its cookie jar and the proxy, TLS and dial settings
+	// of its transport are also used for websocket connections
+	HTTPClient *http.Client
+
+	// Whether to reconnect after the connection is lost
+	Reconnect bool
+
+	// Delay before the first reconnect attempt. Zero uses the default delay
+	ReconnectDelay time.Duration
+
+	// Upper limit of the reconnect delay. Zero limits the delay to 24 hours
+	ReconnectDelayMax time.Duration
+
+	// Multiplier of the delay after each failed attempt. Values below 1 keep the delay constant
+	ReconnectFactor float64
+
+	// Randomization of the delay between 0 and 1.
+	// The delay is changed with up to this fraction in either direction
+	ReconnectJitter float64
+
+	// Maximum number of consecutive reconnect attempts. Zero means unlimited
+	ReconnectAttempts int
+
+	// Maximum number of messages buffered while reconnecting. Zero means unlimited
+	ReconnectBufferSize int
+}
+
+// DefaultConfig returns the settings used by engine.io clients by default
+func DefaultConfig() Config {
+	return Config{
+		Protocol:            4,
+		Transport:           PollingTransport,
+		Upgrade:             true,
+		HTTPClient:          http.DefaultClient,
+		Reconnect:           true,
+		ReconnectDelay:      1 * time.Second,
+		ReconnectDelayMax:   5 * time.Second,
+		ReconnectFactor:     2,
+		ReconnectJitter:     0.5,
+		ReconnectAttempts:   0,
+		ReconnectBufferSize: 100,
+	}
+}
@@ -0,0 +1,20 @@
+package client
+
+import "time"
+
+// ReconnectAttemptEvent is emitted before each reconnect attempt
+type ReconnectAttemptEvent struct {
+	Attempt int
+	Delay   time.Duration
+}
+
+// ReconnectEvent is emitted after a new session is opened by reconnecting
+type ReconnectEvent struct {
+	SessionID string
+	Attempts  int
+}
+
+// ReconnectFailedEvent is emitted when the reconnect attempts are exhausted
+type ReconnectFailedEvent struct {
+	Attempts int
+}
@@ -0,0 +1,111 @@
+package client
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/byonchev/go-engine.io/internal/logger"
+)
+
+// maxReconnectDelay limits the reconnect delay if ReconnectDelayMax is not set
+const maxReconnectDelay = 24 * time.Hour
+
+// backoff computes exponentially growing delays randomized by the jitter factor
+type backoff struct {
+	min    time.Duration
+	max    time.Duration
+	factor float64
+	jitter float64
+
+	attempts int
+	exponent int
+	random   *rand.Rand
+}
+
+func newBackoff(config Config) *backoff {
+	max := config.ReconnectDelayMax
+
+	if max <= 0 || max > maxReconnectDelay {
+		max = maxReconnectDelay
+	}
+
+	return &backoff{
+		min:    config.ReconnectDelay,
+		max:    max,
+		factor: config.ReconnectFactor,
+		jitter: config.ReconnectJitter,
+
+		random: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// next returns the delay before the next attempt
+func (backoff *backoff) next() time.Duration {
+	limit := float64(backoff.max)
+	delay := float64(backoff.min) * math.Pow(backoff.factor, float64(backoff.exponent))
+
+	backoff.attempts++
+
+	// the delay stops growing once it reaches the limit
+	if delay >= limit {
+		delay = limit
+	} else if delay > 0 {
+		backoff.exponent++
+	}
+
+	if backoff.jitter > 0 {
+		deviation := backoff.random.Float64() * backoff.jitter * delay
+
+		if backoff.random.Intn(2) == 0 {
+			delay -= deviation
+		} else {
+			delay += deviation
+		}
+	}
+
+	if delay > limit {
+		return backoff.max
+	}
+
+	return time.Duration(delay)
+}
+
+// reconnect opens new session until an attempt succeeds, the attempts
+// are exhausted or the client is closed
+func (client *Client) reconnect() {
+	backoff := newBackoff(client.config)
+
+	for {
+		attempt := backoff.attempts + 1
+
+		if client.config.ReconnectAttempts > 0 && attempt > client.config.ReconnectAttempts {
+			client.emit(ReconnectFailedEvent{Attempts: backoff.attempts})
+			client.finish()
+
+			return
+		}
+
+		delay := backoff.next()
+
+		client.emit(ReconnectAttemptEvent{Attempt: attempt, Delay: delay})
+
+		select {
+		case <-time.After(delay):
+		case <-client.done:
+			client.finish()
+			return
+		}
+
+		err := client.open()
+
+		if err == nil {
+			client.emit(ReconnectEvent{SessionID: client.ID(), Attempts: attempt})
+			return
+		}
+
+		logger.Error("Reconnect attempt ", attempt, " failed: ", err)
+
+		client.emitError(err)
+	}
+}
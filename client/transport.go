@@ -0,0 +1,233 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/byonchev/go-engine.io/internal/codec"
+	"github.com/byonchev/go-engine.io/internal/packet"
+	"github.com/byonchev/go-engine.io/internal/protocol"
+	"github.com/gorilla/websocket"
+)
+
+// transport exchanges packets with the server
+type transport interface {
+	Type() string
+	Send(packet.Payload) error
+	Receive() (packet.Payload, error)
+	Close() error
+}
+
+// polling sends packets with POST requests and receives them with long polling GET requests
+type polling struct {
+	client   *http.Client
+	url      string
+	header   http.Header
+	protocol protocol.Version
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func newPolling(client *http.Client, url string, header http.Header, protocol protocol.Version) *polling {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &polling{
+		client:   client,
+		url:      url,
+		header:   header,
+		protocol: protocol,
+
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+func (transport *polling) Type() string {
+	return PollingTransport
+}
+
+func (transport *polling) Send(payload packet.Payload) error {
+	var body bytes.Buffer
+
+	err := transport.codec().Encode(payload, &body)
+
+	if err != nil {
+		return err
+	}
+
+	response, err := transport.do("POST", &body)
+
+	if err != nil {
+		return err
+	}
+
+	response.Body.Close()
+
+	return nil
+}
+
+func (transport *polling) Receive() (packet.Payload, error) {
+	response, err := transport.do("GET", nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer response.Body.Close()
+
+	return transport.codec().Decode(response.Body)
+}
+
+func (transport *polling) Close() error {
+	transport.cancel()
+
+	return nil
+}
+
+func (transport *polling) do(method string, body *bytes.Buffer) (*http.Response, error) {
+	var request *http.Request
+	var err error
+
+	if body != nil {
+		request, err = http.NewRequest(method, transport.url, body)
+	} else {
+		request, err = http.NewRequest(method, transport.url, nil)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	for key, values := range transport.header {
+		request.Header[key] = values
+	}
+
+	if body != nil {
+		request.Header.Set("Content-Type", "text/plain;charset=UTF-8")
+	}
+
+	response, err := transport.client.Do(request.WithContext(transport.ctx))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode != http.StatusOK {
+		response.Body.Close()
+
+		return nil, errors.New("unexpected polling response status: " + response.Status)
+	}
+
+	return response, nil
+}
+
+func (transport *polling) codec() codec.Codec {
+	return codec.XHR{Protocol: transport.protocol}
+}
+
+// websocketTransport exchanges a single packet per websocket frame
+type websocketTransport struct {
+	socket   *websocket.Conn
+	protocol protocol.Version
+
+	writeLock sync.Mutex
+}
+
+func dialWebsocket(client *http.Client, url string, header http.Header, protocol protocol.Version) (*websocketTransport, error) {
+	socket, _, err := newDialer(client).Dial(url, header)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &websocketTransport{
+		socket:   socket,
+		protocol: protocol,
+	}, nil
+}
+
+// newDialer creates websocket dialer with the cookie jar, proxy, TLS and dial settings
+// of the client used for polling requests
+func newDialer(client *http.Client) *websocket.Dialer {
+	dialer := *websocket.DefaultDialer
+
+	dialer.Jar = client.Jar
+
+	if client.Timeout > 0 {
+		dialer.HandshakeTimeout = client.Timeout
+	}
+
+	roundTripper := client.Transport
+
+	if roundTripper == nil {
+		roundTripper = http.DefaultTransport
+	}
+
+	if transport, ok := roundTripper.(*http.Transport); ok {
+		dialer.Proxy = transport.Proxy
+		dialer.TLSClientConfig = transport.TLSClientConfig
+		dialer.NetDialContext = transport.DialContext
+	}
+
+	return &dialer
+}
+
+func (transport *websocketTransport) Type() string {
+	return WebsocketTransport
+}
+
+func (transport *websocketTransport) Send(payload packet.Payload) error {
+	transport.writeLock.Lock()
+	defer transport.writeLock.Unlock()
+
+	for _, message := range payload {
+		messageType := websocket.TextMessage
+
+		if message.Binary {
+			messageType = websocket.BinaryMessage
+		}
+
+		writer, err := transport.socket.NextWriter(messageType)
+
+		if err != nil {
+			return err
+		}
+
+		err = codec.Websocket{Protocol: transport.protocol}.Encode(packet.Payload{message}, writer)
+
+		if err != nil {
+			return err
+		}
+
+		err = writer.Close()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (transport *websocketTransport) Receive() (packet.Payload, error) {
+	messageType, reader, err := transport.socket.NextReader()
+
+	if err != nil {
+		return nil, err
+	}
+
+	codec := codec.Websocket{
+		Protocol:    transport.protocol,
+		BinaryFrame: messageType == websocket.BinaryMessage,
+	}
+
+	return codec.Decode(reader)
+}
+
+func (transport *websocketTransport) Close() error {
+	return transport.socket.Close()
+}
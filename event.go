@@ -1,19 +1,40 @@
 package eio
 
+import (
+	"github.com/byonchev/go-engine.io/event"
+	"github.com/byonchev/go-engine.io/internal/dispatch"
+)
+
+// Policies applied when a message is received while the socket event queue is full
+const (
+	// OverflowBlock stops receiving from the transport until the queue has space
+	OverflowBlock = dispatch.Block
+
+	// OverflowDropOldest discards the oldest message waiting in the queue
+	OverflowDropOldest = dispatch.DropOldest
+
+	// OverflowClose closes the session
+	OverflowClose = dispatch.Reject
+)
+
 // ConnectEvent is emitted on new client connection
-type ConnectEvent struct {
-	SessionID string
-}
+type ConnectEvent = event.Connect
 
 // DisconnectEvent is emitted on client connection timeout
-type DisconnectEvent struct {
-	SessionID string
-	Reason    string
-}
+type DisconnectEvent = event.Disconnect
 
 // MessageEvent is emitted on received client message
-type MessageEvent struct {
-	SessionID string
-	Binary    bool
-	Data      []byte
-}
+type MessageEvent = event.Message
+
+// UpgradeEvent is emitted after the client transport is upgraded
+type UpgradeEvent = event.Upgrade
+
+// UpgradeFailedEvent is emitted when transport upgrade is aborted
+// and the client stays on its current transport
+type UpgradeFailedEvent = event.UpgradeFailed
+
+// ErrorEvent is emitted on session errors
+type ErrorEvent = event.Error
+
+// drainEvent is dispatched to socket handlers only
+type drainEvent struct{}
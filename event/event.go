@@ -0,0 +1,40 @@
+// Package event defines the connection events shared by the engine.io server and client
+package event
+
+// Connect is emitted on new client connection
+type Connect struct {
+	SessionID string
+}
+
+// Disconnect is emitted on client connection timeout
+type Disconnect struct {
+	SessionID string
+	Reason    string
+}
+
+// Message is emitted on received client message
+type Message struct {
+	SessionID string
+	Binary    bool
+	Data      []byte
+}
+
+// Upgrade is emitted after the client transport is upgraded
+type Upgrade struct {
+	SessionID string
+	Transport string
+}
+
+// UpgradeFailed is emitted when transport upgrade is aborted
+// and the client stays on its current transport
+type UpgradeFailed struct {
+	SessionID string
+	Transport string
+	Reason    string
+}
+
+// Error is emitted on session errors
+type Error struct {
+	SessionID string
+	Error     error
+}
@@ -10,22 +10,19 @@ import (
 func main() {
 	engineIO := eio.NewServer()
 
-	events := engineIO.Events()
-
-	go func() {
-		for event := range events {
-			switch event := event.(type) {
-			case eio.MessageEvent:
-				fmt.Printf("Message received from %s: %s\n", event.SessionID, string(event.Data))
-			case eio.ConnectEvent:
-				fmt.Printf("Client %s connected\n", event.SessionID)
-
-				engineIO.Send(event.SessionID, false, []byte("Hello"))
-			case eio.DisconnectEvent:
-				fmt.Printf("Client %s disconnected. Reason: %s\n", event.SessionID, event.Reason)
-			}
-		}
-	}()
+	engineIO.OnConnection(func(socket *eio.Socket) {
+		fmt.Printf("Client %s connected\n", socket.ID())
+
+		socket.OnMessage(func(binary bool, data []byte) {
+			fmt.Printf("Message received from %s: %s\n", socket.ID(), string(data))
+		})
+
+		socket.OnClose(func(reason string) {
+			fmt.Printf("Client %s disconnected. Reason: %s\n", socket.ID(), reason)
+		})
+
+		socket.Send(false, []byte("Hello"))
+	})
 
 	http.Handle("/engine.io/", engineIO)
 	http.ListenAndServe(":8080", nil)
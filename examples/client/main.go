@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/byonchev/go-engine.io/client"
+)
+
+func main() {
+	engineIO, err := client.NewClient("http://localhost:8080/engine.io/", client.DefaultConfig())
+
+	if err != nil {
+		panic(err)
+	}
+
+	engineIO.OnOpen(func() {
+		fmt.Printf("Connected with session %s\n", engineIO.ID())
+
+		engineIO.Send(false, []byte("Hello"))
+	})
+
+	engineIO.OnMessage(func(binary bool, data []byte) {
+		fmt.Printf("Message received: %s\n", string(data))
+	})
+
+	engineIO.OnUpgrade(func(transport string) {
+		fmt.Printf("Transport upgraded to %s\n", transport)
+	})
+
+	engineIO.OnClose(func(reason string) {
+		fmt.Printf("Disconnected. Reason: %s\n", reason)
+	})
+
+	err = engineIO.Connect()
+
+	if err != nil {
+		panic(err)
+	}
+
+	time.Sleep(time.Minute)
+
+	engineIO.Close()
+}
@@ -22,6 +22,8 @@ func main() {
 	engineIO.Transports = []string{"polling"}
 	engineIO.PollingBufferFlushLimit = 100
 	engineIO.PollingBufferReceiveLimit = 50
+	engineIO.EventQueueSize = 20
+	engineIO.EventQueueOverflow = eio.OverflowDropOldest
 
 	events := engineIO.Events()
 
@@ -0,0 +1,6 @@
+package eio
+
+// SchedulerStopped reports whether the heartbeat scheduler of the server was stopped
+func SchedulerStopped(server *Server) bool {
+	return server.scheduler.Stopped()
+}
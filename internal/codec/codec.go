@@ -11,3 +11,60 @@ type Codec interface {
 	Encode(packet.Payload, io.Writer) error
 	Decode(io.Reader) (packet.Payload, error)
 }
+
+// StreamCodec is a codec which decodes the packets of a payload one at a time
+// while reading it, without buffering the whole payload
+type StreamCodec interface {
+	Codec
+
+	// DecodeStream passes each packet to the handler as soon as it is decoded.
+	// Packets preceding an invalid one are still passed to the handler
+	DecodeStream(io.Reader, func(packet.Packet)) error
+}
+
+// Packet formats shared through the packet encoding cache
+const (
+	websocketV3Format packet.Format = iota
+	websocketV4Format
+	xhrStringFormat
+	xhrBinaryFormat
+	xhrSeparatedFormat
+	jsonpStringFormat
+	jsonpSeparatedFormat
+	framedFormat
+	sseV3Format
+	sseV4Format
+)
+
+// writePackets writes the encoded packets of the payload delimited by the separator
+func writePackets(payload packet.Payload, writer io.Writer, separator []byte, format packet.Format, encode func(packet.Packet) []byte) error {
+	for i, message := range payload {
+		if i > 0 && len(separator) > 0 {
+			_, err := writer.Write(separator)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err := writer.Write(encodeCached(message, format, encode))
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// encodeCached returns the shared encoding of packets sent to multiple sessions
+// or encodes packets without cache
+func encodeCached(message packet.Packet, format packet.Format, encode func(packet.Packet) []byte) []byte {
+	if message.Cache == nil {
+		return encode(message)
+	}
+
+	return message.Cache.Encoding(format, func() []byte {
+		return encode(message)
+	})
+}
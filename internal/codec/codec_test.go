@@ -1,7 +1,16 @@
 package codec_test
 
 import (
+	"bytes"
 	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/byonchev/go-engine.io/internal/codec"
+	"github.com/byonchev/go-engine.io/internal/packet"
+	"github.com/byonchev/go-engine.io/internal/protocol"
+	"github.com/stretchr/testify/assert"
 )
 
 type errorReader struct{}
@@ -15,3 +24,86 @@ type errorWriter struct{}
 func (writer errorWriter) Write([]byte) (int, error) {
 	return 10, errors.New("error")
 }
+
+func TestEncodeBroadcast(t *testing.T) {
+	codecs := []codec.Codec{
+		codec.Websocket{},
+		codec.Websocket{Protocol: protocol.V4},
+		codec.XHR{},
+		codec.XHR{ForceBase64: true},
+		codec.XHR{Protocol: protocol.V4},
+		codec.JSONP{Index: "1"},
+		codec.JSONP{Index: "2", Protocol: protocol.V4},
+	}
+
+	payloads := []packet.Payload{
+		{packet.NewStringMessage("hello  ")},
+		{packet.NewBinaryMessage([]byte{1, 2, 3})},
+		{packet.NewStringMessage("hello"), packet.NewBinaryMessage([]byte{4, 5})},
+	}
+
+	for _, payload := range payloads {
+		var broadcast packet.Payload
+
+		for _, message := range payload {
+			broadcast = append(broadcast, packet.NewBroadcast(message.Binary, message.Data))
+		}
+
+		for _, codec := range codecs {
+			var expected, actual, cached bytes.Buffer
+
+			codec.Encode(payload, &expected)
+
+			err := codec.Encode(broadcast, &actual)
+
+			assert.Nil(t, err, "error while encoding broadcast")
+			assert.Equal(t, expected.Bytes(), actual.Bytes(), "broadcast was not encoded properly")
+
+			codec.Encode(broadcast, &cached)
+
+			assert.Equal(t, expected.Bytes(), cached.Bytes(), "cached broadcast was not encoded properly")
+		}
+	}
+}
+
+// BenchmarkEncodeBroadcast compares encoding a message for each recipient
+// with encoding a broadcast once and sharing it between the recipients
+func BenchmarkEncodeBroadcast(b *testing.B) {
+	const recipients = 100
+
+	codecs := []struct {
+		name  string
+		codec codec.Codec
+	}{
+		{"websocket", codec.Websocket{Protocol: protocol.V4}},
+		{"xhr", codec.XHR{Protocol: protocol.V4}},
+		{"xhr-base64", codec.XHR{ForceBase64: true}},
+		{"jsonp", codec.JSONP{Index: "1", Protocol: protocol.V4}},
+	}
+
+	messages := []struct {
+		name   string
+		create func(bool, []byte) packet.Packet
+	}{
+		{"per-recipient", packet.NewMessage},
+		{"shared", packet.NewBroadcast},
+	}
+
+	data := []byte(strings.Repeat("hello world ", 100))
+
+	for _, test := range codecs {
+		for _, message := range messages {
+			b.Run(test.name+"/"+message.name, func(b *testing.B) {
+				b.ReportAllocs()
+
+				for n := 0; n < b.N; n++ {
+					payload := packet.Payload{message.create(false, data)}
+
+					for i := 0; i < recipients; i++ {
+						test.codec.Encode(payload, ioutil.Discard)
+					}
+				}
+			})
+		}
+	}
+}
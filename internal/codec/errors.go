@@ -0,0 +1,48 @@
+package codec
+
+import (
+	"errors"
+
+	"github.com/byonchev/go-engine.io/internal/packet"
+)
+
+// errEmptyPayload is returned for empty polling requests and responses,
+// which are not treated as malformed
+var errEmptyPayload = errors.New("payload is empty")
+
+// ErrPacketTooLarge is returned when a length-prefixed packet exceeds the allowed length
+var ErrPacketTooLarge = errors.New("packet too large")
+
+// DecodeError is returned when the payload is malformed
+// or contains packets violating the protocol
+type DecodeError struct {
+	Err error
+}
+
+func (err *DecodeError) Error() string {
+	return err.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (err *DecodeError) Unwrap() error {
+	return err.Err
+}
+
+func newDecodeError(reason string) error {
+	return &DecodeError{errors.New(reason)}
+}
+
+// validatePacket fails decoding of packets violating the protocol
+func validatePacket(decoded packet.Packet, err error) (packet.Packet, error) {
+	if err != nil {
+		return packet.Packet{}, err
+	}
+
+	err = decoded.Validate()
+
+	if err != nil {
+		return packet.Packet{}, &DecodeError{err}
+	}
+
+	return decoded, nil
+}
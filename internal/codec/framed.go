@@ -0,0 +1,168 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+
+	"github.com/byonchev/go-engine.io/internal/packet"
+)
+
+// Length prefix markers of the framed packet header
+const (
+	framedBinaryFlag = 0x80
+	framedLength16   = 126
+	framedLength64   = 127
+)
+
+// Framed is a codec for the length-prefixed packets sent over WebTransport streams
+// and raw connections. Each packet is preceded by its length, with the highest bit
+// of the header set for binary packets
+type Framed struct {
+	// Whether the decoded packet is the first one on the stream.
+	// WebTransport clients open the stream with an open packet,
+	// which has no data for new sessions
+	Handshake bool
+
+	// Packets longer than MaxLength fail with ErrPacketTooLarge. Zero means no limit
+	MaxLength int64
+}
+
+// Encode writes each packet of the payload with its length prefix
+func (codec Framed) Encode(payload packet.Payload, writer io.Writer) error {
+	return writePackets(payload, writer, nil, framedFormat, codec.encodePacket)
+}
+
+// Decode reads a single packet from the stream.
+// io.EOF is returned if the stream ends before the next packet
+func (codec Framed) Decode(reader io.Reader) (packet.Payload, error) {
+	binaryPacket, length, err := codec.readHeader(reader)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var body bytes.Buffer
+
+	// the buffer grows with the received data instead of trusting the declared length
+	_, err = io.CopyN(&body, reader, length)
+
+	if err == io.EOF {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	decoded, err := codec.decodePacket(binaryPacket, body.Bytes())
+
+	if err != nil {
+		return nil, err
+	}
+
+	return packet.Payload{decoded}, nil
+}
+
+func (codec Framed) readHeader(reader io.Reader) (bool, int64, error) {
+	header := make([]byte, 8)
+
+	_, err := io.ReadFull(reader, header[:1])
+
+	if err != nil {
+		return false, 0, err
+	}
+
+	binaryPacket := header[0]&framedBinaryFlag != 0
+	length := int64(header[0] &^ framedBinaryFlag)
+
+	switch length {
+	case framedLength16:
+		_, err = io.ReadFull(reader, header[:2])
+		length = int64(binary.BigEndian.Uint16(header))
+	case framedLength64:
+		_, err = io.ReadFull(reader, header)
+		length = int64(binary.BigEndian.Uint64(header))
+	}
+
+	if err == io.EOF {
+		return false, 0, io.ErrUnexpectedEOF
+	}
+
+	if err != nil {
+		return false, 0, err
+	}
+
+	if length < 0 || length > int64(maxPacketLength) {
+		return false, 0, newDecodeError("invalid packet length")
+	}
+
+	if codec.MaxLength > 0 && length > codec.MaxLength {
+		return false, 0, ErrPacketTooLarge
+	}
+
+	return binaryPacket, length, nil
+}
+
+func (codec Framed) decodePacket(binaryPacket bool, data []byte) (packet.Packet, error) {
+	if binaryPacket && codec.Handshake {
+		return packet.Packet{}, newDecodeError("expected open packet")
+	}
+
+	if binaryPacket {
+		return validatePacket(packet.NewBinaryMessage(data), nil)
+	}
+
+	if len(data) == 0 {
+		return packet.Packet{}, newDecodeError("invalid packet type")
+	}
+
+	decoded := packet.Packet{
+		Type: packet.TypeFromChar(data[0]),
+		Data: data[1:],
+	}
+
+	if !codec.Handshake {
+		return validatePacket(decoded, nil)
+	}
+
+	if decoded.Type != packet.Open {
+		return packet.Packet{}, newDecodeError("expected open packet")
+	}
+
+	return decoded, nil
+}
+
+func (codec Framed) encodePacket(message packet.Packet) []byte {
+	body := message.Data
+
+	if !message.Binary {
+		body = make([]byte, len(message.Data)+1)
+
+		body[0] = message.Type.Char()
+		copy(body[1:], message.Data)
+	}
+
+	length := len(body)
+
+	var header []byte
+
+	switch {
+	case length < framedLength16:
+		header = []byte{byte(length)}
+	case length <= 0xffff:
+		header = make([]byte, 3)
+		header[0] = framedLength16
+		binary.BigEndian.PutUint16(header[1:], uint16(length))
+	default:
+		header = make([]byte, 9)
+		header[0] = framedLength64
+		binary.BigEndian.PutUint64(header[1:], uint64(length))
+	}
+
+	if message.Binary {
+		header[0] |= framedBinaryFlag
+	}
+
+	return append(header, body...)
+}
@@ -0,0 +1,145 @@
+package codec_test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/byonchev/go-engine.io/internal/codec"
+	"github.com/byonchev/go-engine.io/internal/packet"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFramedEncode(t *testing.T) {
+	codec := codec.Framed{}
+
+	tests := []struct {
+		payload packet.Payload
+		encoded []byte
+	}{
+		{
+			packet.Payload{packet.NewStringMessage("hello")},
+			[]byte("\x064hello"),
+		},
+		{
+			packet.Payload{packet.NewBinaryMessage([]byte{1, 2, 3})},
+			[]byte{0x83, 1, 2, 3},
+		},
+		{
+			packet.Payload{packet.NewPing([]byte("probe")), packet.NewClose()},
+			[]byte("\x062probe\x011"),
+		},
+		{
+			packet.Payload{packet.NewStringMessage(strings.Repeat("a", 199))},
+			append([]byte{126, 0, 200, '4'}, strings.Repeat("a", 199)...),
+		},
+		{
+			packet.Payload{packet.NewBinaryMessage(make([]byte, 70000))},
+			append([]byte{0xff, 0, 0, 0, 0, 0, 1, 0x11, 0x70}, make([]byte, 70000)...),
+		},
+	}
+
+	for _, test := range tests {
+		var buffer bytes.Buffer
+
+		err := codec.Encode(test.payload, &buffer)
+
+		assert.Nil(t, err, "error while encoding valid payload")
+		assert.Equal(t, test.encoded, buffer.Bytes(), "payload was not encoded properly")
+	}
+}
+
+func TestFramedDecode(t *testing.T) {
+	codec := codec.Framed{}
+
+	tests := []struct {
+		data    []byte
+		decoded packet.Payload
+	}{
+		{
+			[]byte("\x064hello"),
+			packet.Payload{packet.NewStringMessage("hello")},
+		},
+		{
+			[]byte{0x83, 1, 2, 3},
+			packet.Payload{packet.NewBinaryMessage([]byte{1, 2, 3})},
+		},
+		{
+			append([]byte{126, 0, 200, '4'}, strings.Repeat("a", 199)...),
+			packet.Payload{packet.NewStringMessage(strings.Repeat("a", 199))},
+		},
+	}
+
+	for _, test := range tests {
+		decoded, err := codec.Decode(bytes.NewReader(test.data))
+
+		assert.Nil(t, err, "error while decoding valid packet")
+		assert.Equal(t, test.decoded, decoded, "packet was not decoded properly")
+	}
+}
+
+func TestFramedDecodeStream(t *testing.T) {
+	codec := codec.Framed{}
+
+	reader := bytes.NewReader([]byte("\x062probe\x011"))
+
+	first, err := codec.Decode(reader)
+
+	assert.Nil(t, err, "error while decoding first packet")
+	assert.Equal(t, packet.Payload{packet.NewPing([]byte("probe"))}, first, "first packet was not decoded")
+
+	second, err := codec.Decode(reader)
+
+	assert.Nil(t, err, "error while decoding second packet")
+	assert.Equal(t, packet.Payload{packet.NewClose()}, second, "second packet was not decoded")
+
+	_, err = codec.Decode(reader)
+
+	assert.Equal(t, io.EOF, err, "end of stream was not reported")
+}
+
+func TestFramedDecodeHandshake(t *testing.T) {
+	tests := []struct {
+		data      []byte
+		handshake bool
+		valid     bool
+	}{
+		{[]byte("\x010"), true, true},
+		{[]byte("\x0c0{\"sid\":\"a\"}"), true, true},
+		{[]byte("\x010"), false, false},
+		{[]byte("\x064hello"), true, false},
+		{[]byte{0x81, 0}, true, false},
+	}
+
+	for _, test := range tests {
+		_, err := codec.Framed{Handshake: test.handshake}.Decode(bytes.NewReader(test.data))
+
+		assert.Equal(t, test.valid, err == nil, "wrong validation of "+string(test.data))
+	}
+}
+
+func TestFramedDecodeErrors(t *testing.T) {
+	tests := []struct {
+		data     []byte
+		expected error
+	}{
+		{[]byte{0}, &codec.DecodeError{}},
+		{[]byte("\x019"), &codec.DecodeError{}},
+		{[]byte{0xff, 0x80, 0, 0, 0, 0, 0, 0, 0}, &codec.DecodeError{}},
+		{[]byte("\x064he"), io.ErrUnexpectedEOF},
+		{[]byte{126, 0}, io.ErrUnexpectedEOF},
+		{[]byte("\x0b4hello world"), codec.ErrPacketTooLarge},
+	}
+
+	for _, test := range tests {
+		decoded, err := codec.Framed{MaxLength: 10}.Decode(bytes.NewReader(test.data))
+
+		assert.Nil(t, decoded, "packet was decoded with error")
+		assert.IsType(t, test.expected, err, "wrong error for "+string(test.data))
+
+		if _, ok := test.expected.(*codec.DecodeError); !ok {
+			assert.Equal(t, test.expected, err, "wrong error for "+string(test.data))
+		}
+	}
+}
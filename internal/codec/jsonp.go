@@ -2,18 +2,19 @@ package codec
 
 import (
 	"bytes"
-	"errors"
 	"io"
 	"io/ioutil"
 	"net/url"
 	"strings"
 
 	"github.com/byonchev/go-engine.io/internal/packet"
+	"github.com/byonchev/go-engine.io/internal/protocol"
 )
 
 // JSONP is a codec for encoding messages for cross-domain polling
 type JSONP struct {
 	Index    string
+	Protocol protocol.Version
 	delegate XHR
 }
 
@@ -21,16 +22,37 @@ const hexCharacters = "0123456789abcdef"
 
 // Encode encodes payload of packets for single poll
 func (codec JSONP) Encode(payload packet.Payload, writer io.Writer) error {
+	codec.delegate.ForceBase64 = true
+	codec.delegate.Protocol = codec.Protocol
+
+	_, encode := codec.delegate.packetEncoder(payload)
+
+	escape := func(packet packet.Packet) []byte {
+		return codec.escape(string(encode(packet)))
+	}
+
+	format := jsonpStringFormat
+
+	var separator []byte
+
+	if codec.Protocol == protocol.V4 {
+		format = jsonpSeparatedFormat
+		separator = codec.escape(string(recordSeparator))
+	}
+
 	var buffer bytes.Buffer
 
-	codec.delegate.ForceBase64 = true
-	codec.delegate.Encode(payload, &buffer)
+	buffer.WriteString("___eio[" + codec.Index + "](\"")
 
-	bytes := []byte("___eio[" + codec.Index + "](\"")
-	bytes = append(bytes, codec.escape(buffer.String())...)
-	bytes = append(bytes, []byte("\");")...)
+	err := writePackets(payload, &buffer, separator, format, escape)
 
-	_, err := writer.Write(bytes)
+	if err != nil {
+		return err
+	}
+
+	buffer.WriteString("\");")
+
+	_, err = writer.Write(buffer.Bytes())
 
 	return err
 }
@@ -43,17 +65,19 @@ func (codec JSONP) Decode(reader io.Reader) (packet.Payload, error) {
 		return nil, err
 	}
 
-	if len(data) < 2 {
-		return nil, errors.New("invalid form data")
-	}
-
-	query, err := url.QueryUnescape(string(data[2:]))
+	form, err := url.ParseQuery(string(data))
 
 	if err != nil {
-		return nil, err
+		return nil, &DecodeError{err}
 	}
 
-	buffer := bytes.NewBufferString(codec.unescape(query))
+	if _, found := form["d"]; !found {
+		return nil, newDecodeError("invalid form data")
+	}
+
+	buffer := bytes.NewBufferString(codec.unescape(form.Get("d")))
+
+	codec.delegate.Protocol = codec.Protocol
 
 	return codec.delegate.Decode(buffer)
 }
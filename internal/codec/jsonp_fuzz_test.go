@@ -0,0 +1,78 @@
+package codec_test
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/byonchev/go-engine.io/internal/codec"
+	"github.com/byonchev/go-engine.io/internal/packet"
+	"github.com/byonchev/go-engine.io/internal/protocol"
+	"github.com/stretchr/testify/assert"
+)
+
+func FuzzJSONPDecode(f *testing.F) {
+	seeds := []string{
+		`d=4:4\\n\\\\n`,
+		"d=6:4hello6:4world6:3probe",
+		"d=6:b4AgQI",
+		"d=4hello%1ebAgQI",
+		"d=-1:4",
+		"123%",
+	}
+
+	for _, seed := range seeds {
+		f.Add([]byte(seed), false)
+		f.Add([]byte(seed), true)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte, v4 bool) {
+		jsonp := codec.JSONP{}
+
+		if v4 {
+			jsonp.Protocol = protocol.V4
+		}
+
+		payload, err := jsonp.Decode(bytes.NewReader(data))
+
+		if err != nil {
+			assert.Empty(t, payload, "payload was decoded with error")
+		}
+	})
+}
+
+func FuzzJSONPRoundTrip(f *testing.F) {
+	f.Add("hello", []byte{1, 2, 3})
+	f.Add("hello ❤ wörld 👋 &d=", []byte{})
+
+	f.Fuzz(func(t *testing.T, text string, binary []byte) {
+		if !utf8.ValidString(text) || strings.ContainsAny(text, "\\\n\x1e") {
+			return
+		}
+
+		payload := packet.Payload{
+			packet.NewStringMessage(text),
+			packet.NewBinaryMessage(binary),
+		}
+
+		for _, version := range []protocol.Version{protocol.V3, protocol.V4} {
+			var buffer bytes.Buffer
+
+			codec.XHR{ForceBase64: true, Protocol: version}.Encode(payload, &buffer)
+
+			form := url.Values{"d": {buffer.String()}}.Encode()
+
+			decoded, err := codec.JSONP{Protocol: version}.Decode(strings.NewReader(form))
+
+			assert.Nil(t, err, "error while decoding encoded form")
+			assert.Equal(t, len(payload), len(decoded), "wrong number of decoded packets")
+
+			for i := range decoded {
+				assert.Equal(t, payload[i].Binary, decoded[i].Binary, "packet kind was not preserved")
+				assert.True(t, bytes.Equal(payload[i].Data, decoded[i].Data), "packet data was not preserved")
+			}
+		}
+	})
+}
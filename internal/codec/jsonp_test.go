@@ -6,6 +6,7 @@ import (
 
 	"github.com/byonchev/go-engine.io/internal/codec"
 	"github.com/byonchev/go-engine.io/internal/packet"
+	"github.com/byonchev/go-engine.io/internal/protocol"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -129,6 +130,8 @@ func TestJSONPDecodeErrors(t *testing.T) {
 		[]byte("d=1:30:"),
 		[]byte("d=6:b4AGQI0:"),
 		[]byte("d=8:bINVALID_BASE64"),
+		[]byte("x=6:4hello"),
+		[]byte("d=-1:4"),
 	}
 
 	for _, test := range tests {
@@ -147,6 +150,27 @@ func TestJSONPDecodeReaderError(t *testing.T) {
 	assert.Error(t, err, "reader error was expected")
 }
 
+func TestJSONPV4(t *testing.T) {
+	codec := codec.JSONP{Index: "0", Protocol: protocol.V4}
+
+	payload := packet.Payload{
+		packet.NewStringMessage("hello"),
+		packet.NewBinaryMessage([]byte{2, 4, 8}),
+	}
+
+	var buffer bytes.Buffer
+
+	err := codec.Encode(payload, &buffer)
+
+	assert.Nil(t, err, "error while encoding payload")
+	assert.Equal(t, "___eio[0](\"4hello\\u001ebAgQI\");", buffer.String(), "payload was not encoded properly")
+
+	decoded, err := codec.Decode(bytes.NewBufferString("d=4hello%1EbAgQI"))
+
+	assert.Nil(t, err, "error while decoding valid payload")
+	assert.Equal(t, payload, decoded, "payload was not decoded properly")
+}
+
 func BenchmarkJSONPEncode(b *testing.B) {
 	codec := codec.JSONP{Index: "0"}
 
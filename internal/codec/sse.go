@@ -0,0 +1,64 @@
+package codec
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/byonchev/go-engine.io/internal/packet"
+	"github.com/byonchev/go-engine.io/internal/protocol"
+)
+
+// SSE is a codec for pushing packets as server-sent events.
+// Each event carries a single packet as an escaped JavaScript string,
+// so packets containing line breaks fit on a single data line.
+// Packets sent by the client are decoded like polling payloads
+type SSE struct {
+	Protocol protocol.Version
+	delegate XHR
+}
+
+// Encode writes each packet of the payload as a separate event
+func (codec SSE) Encode(payload packet.Payload, writer io.Writer) error {
+	format := sseV3Format
+
+	if codec.Protocol == protocol.V4 {
+		format = sseV4Format
+	}
+
+	return writePackets(payload, writer, nil, format, codec.encodePacket)
+}
+
+// Decode decodes payload of packets sent by the client
+func (codec SSE) Decode(reader io.Reader) (packet.Payload, error) {
+	codec.delegate.Protocol = codec.Protocol
+
+	return codec.delegate.Decode(reader)
+}
+
+// DecodeStream passes each packet sent by the client to the handler as soon as it is decoded
+func (codec SSE) DecodeStream(reader io.Reader, handler func(packet.Packet)) error {
+	codec.delegate.Protocol = codec.Protocol
+
+	return codec.delegate.DecodeStream(reader, handler)
+}
+
+func (codec SSE) encodePacket(message packet.Packet) []byte {
+	var data []byte
+
+	switch {
+	case codec.Protocol == protocol.V4:
+		data = codec.delegate.encodeSeparatedPacket(message)
+	case message.Binary:
+		data = codec.delegate.encodeBase64Data(message)
+	default:
+		data = codec.delegate.encodeStringData(message)
+	}
+
+	var buffer bytes.Buffer
+
+	buffer.WriteString("data: \"")
+	buffer.Write(JSONP{}.escape(string(data)))
+	buffer.WriteString("\"\n\n")
+
+	return buffer.Bytes()
+}
@@ -0,0 +1,85 @@
+package codec_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/byonchev/go-engine.io/internal/codec"
+	"github.com/byonchev/go-engine.io/internal/packet"
+	"github.com/byonchev/go-engine.io/internal/protocol"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSSEEncode(t *testing.T) {
+	tests := []struct {
+		protocol protocol.Version
+		payload  packet.Payload
+		encoded  string
+	}{
+		{
+			protocol.V4,
+			packet.Payload{
+				packet.NewStringMessage("hello"),
+				packet.NewBinaryMessage([]byte{2, 4, 8}),
+			},
+			"data: \"4hello\"\n\ndata: \"bAgQI\"\n\n",
+		},
+		{
+			protocol.V3,
+			packet.Payload{
+				packet.NewOpen([]byte(`{"sid":"a"}`)),
+				packet.NewBinaryMessage([]byte{2, 4, 8}),
+			},
+			"data: \"0{\\\"sid\\\":\\\"a\\\"}\"\n\ndata: \"b4AgQI\"\n\n",
+		},
+		{
+			protocol.V4,
+			packet.Payload{
+				packet.NewStringMessage("line\r\nbreak\u2028"),
+			},
+			"data: \"4line\\r\\nbreak\\u2028\"\n\n",
+		},
+	}
+
+	for _, test := range tests {
+		var buffer bytes.Buffer
+
+		err := codec.SSE{Protocol: test.protocol}.Encode(test.payload, &buffer)
+
+		assert.Nil(t, err, "error while encoding payload")
+		assert.Equal(t, test.encoded, buffer.String(), "payload was not encoded properly")
+	}
+}
+
+func TestSSEDecode(t *testing.T) {
+	tests := []struct {
+		protocol protocol.Version
+		data     string
+		decoded  packet.Payload
+	}{
+		{
+			protocol.V4,
+			"4hello\x1ebAgQI",
+			packet.Payload{
+				packet.NewStringMessage("hello"),
+				packet.NewBinaryMessage([]byte{2, 4, 8}),
+			},
+		},
+		{
+			protocol.V3,
+			"6:4hello2:3a",
+			packet.Payload{
+				packet.NewStringMessage("hello"),
+				packet.NewPong([]byte("a")),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		decoded, err := codec.SSE{Protocol: test.protocol}.Decode(strings.NewReader(test.data))
+
+		assert.Nil(t, err, "error while decoding payload")
+		assert.Equal(t, test.decoded, decoded, "payload was not decoded properly")
+	}
+}
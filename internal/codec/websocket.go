@@ -1,44 +1,47 @@
 package codec
 
 import (
-	"errors"
 	"io"
 	"io/ioutil"
-	"unicode"
 
 	"github.com/byonchev/go-engine.io/internal/packet"
+	"github.com/byonchev/go-engine.io/internal/protocol"
 )
 
 // Websocket is a codec for encoding packets for websocket transport
-type Websocket struct{}
+type Websocket struct {
+	Protocol protocol.Version
+
+	// Whether the decoded frame is a binary one.
+	// Protocol v4 sends binary messages without packet type
+	BinaryFrame bool
+}
 
 // Encode encodes a single packet in payload
 func (codec Websocket) Encode(payload packet.Payload, writer io.Writer) error {
-	if len(payload) == 0 {
-		return nil
-	}
+	format := websocketV3Format
 
-	for _, packet := range payload {
-		err := codec.encodePacket(packet, writer)
-
-		if err != nil {
-			return err
-		}
+	if codec.Protocol == protocol.V4 {
+		format = websocketV4Format
 	}
 
-	return nil
+	return writePackets(payload, writer, nil, format, codec.encodePacket)
 }
 
 // Decode decodes single packet from encoded payload
-func (Websocket) Decode(reader io.Reader) (packet.Payload, error) {
+func (codec Websocket) Decode(reader io.Reader) (packet.Payload, error) {
 	encoded, err := ioutil.ReadAll(reader)
 
 	if err != nil {
 		return nil, err
 	}
 
+	if codec.Protocol == protocol.V4 && codec.BinaryFrame {
+		return packet.Payload{packet.NewBinaryMessage(encoded)}, nil
+	}
+
 	if len(encoded) == 0 {
-		return nil, errors.New("invalid packet type")
+		return nil, newDecodeError("invalid packet type")
 	}
 
 	var binary bool
@@ -46,12 +49,16 @@ func (Websocket) Decode(reader io.Reader) (packet.Payload, error) {
 
 	typeByte := encoded[0]
 
-	if unicode.IsNumber(rune(typeByte)) {
-		binary = false
-		packetType = packet.TypeFromChar(typeByte)
-	} else {
+	// protocol v3 packets are treated as binary unless they start with a digit,
+	// while protocol v4 sends binary packets only in binary frames
+	digit := '0' <= typeByte && typeByte <= '9'
+
+	if codec.BinaryFrame || (codec.Protocol != protocol.V4 && !digit) {
 		binary = true
 		packetType = packet.TypeFromByte(typeByte)
+	} else {
+		binary = false
+		packetType = packet.TypeFromChar(typeByte)
 	}
 
 	data := encoded[1:]
@@ -62,10 +69,20 @@ func (Websocket) Decode(reader io.Reader) (packet.Payload, error) {
 		Data:   data,
 	}
 
+	err = decoded.Validate()
+
+	if err != nil {
+		return nil, &DecodeError{err}
+	}
+
 	return packet.Payload{decoded}, nil
 }
 
-func (codec Websocket) encodePacket(packet packet.Packet, writer io.Writer) error {
+func (codec Websocket) encodePacket(packet packet.Packet) []byte {
+	if codec.Protocol == protocol.V4 && packet.Binary {
+		return packet.Data
+	}
+
 	encoded := make([]byte, len(packet.Data)+1)
 
 	var packetType byte
@@ -79,7 +96,5 @@ func (codec Websocket) encodePacket(packet packet.Packet, writer io.Writer) erro
 	encoded[0] = packetType
 	copy(encoded[1:], packet.Data)
 
-	_, err := writer.Write(encoded)
-
-	return err
+	return encoded
 }
@@ -0,0 +1,88 @@
+package codec_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/byonchev/go-engine.io/internal/codec"
+	"github.com/byonchev/go-engine.io/internal/packet"
+	"github.com/byonchev/go-engine.io/internal/protocol"
+	"github.com/stretchr/testify/assert"
+)
+
+func FuzzWebsocketDecode(f *testing.F) {
+	seeds := [][]byte{
+		[]byte("4hello"),
+		[]byte{4, 0, 1},
+		[]byte{'1'},
+		[]byte{0xb2, 1},
+		[]byte{},
+	}
+
+	for _, seed := range seeds {
+		f.Add(seed, false, false)
+		f.Add(seed, true, false)
+		f.Add(seed, false, true)
+		f.Add(seed, true, true)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte, v4 bool, binaryFrame bool) {
+		websocket := codec.Websocket{BinaryFrame: binaryFrame}
+
+		if v4 {
+			websocket.Protocol = protocol.V4
+		}
+
+		payload, err := websocket.Decode(bytes.NewReader(data))
+
+		if err != nil {
+			assert.Empty(t, payload, "payload was decoded with error")
+			return
+		}
+
+		assert.Len(t, payload, 1, "frame was not decoded to a single packet")
+
+		var buffer bytes.Buffer
+
+		websocket.Encode(payload, &buffer)
+
+		websocket.BinaryFrame = payload[0].Binary
+
+		decoded, err := websocket.Decode(&buffer)
+
+		assert.Nil(t, err, "error while decoding encoded packet")
+		assert.Equal(t, payload, decoded, "decoded packet was not encoded properly")
+	})
+}
+
+func FuzzWebsocketRoundTrip(f *testing.F) {
+	f.Add(false, byte(packet.Message), []byte("hello"))
+	f.Add(true, byte(packet.Message), []byte{0, 1, 2})
+	f.Add(false, byte(packet.Ping), []byte("probe"))
+
+	f.Fuzz(func(t *testing.T, binary bool, packetType byte, data []byte) {
+		message := packet.Packet{Binary: binary, Type: packet.Type(packetType), Data: data}
+
+		if message.Validate() != nil {
+			return
+		}
+
+		for _, version := range []protocol.Version{protocol.V3, protocol.V4} {
+			websocket := codec.Websocket{Protocol: version}
+
+			var buffer bytes.Buffer
+
+			websocket.Encode(packet.Payload{message}, &buffer)
+
+			websocket.BinaryFrame = binary
+
+			decoded, err := websocket.Decode(&buffer)
+
+			assert.Nil(t, err, "error while decoding encoded packet")
+			assert.Len(t, decoded, 1, "frame was not decoded to a single packet")
+			assert.Equal(t, message.Binary, decoded[0].Binary, "packet kind was not preserved")
+			assert.Equal(t, message.Type, decoded[0].Type, "packet type was not preserved")
+			assert.True(t, bytes.Equal(message.Data, decoded[0].Data), "packet data was not preserved")
+		}
+	})
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/byonchev/go-engine.io/internal/codec"
 	"github.com/byonchev/go-engine.io/internal/packet"
+	"github.com/byonchev/go-engine.io/internal/protocol"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -106,17 +107,37 @@ func TestWebsocketDecode(t *testing.T) {
 	}
 }
 
-func TestWebsocketDecodeErrors(t *testing.T) {
-	codec := codec.Websocket{}
+func TestWebsocketDecodeBinaryFrame(t *testing.T) {
+	decoder := codec.Websocket{BinaryFrame: true}
 
-	data := []byte{}
+	actual, err := decoder.Decode(bytes.NewBuffer([]byte{4, 0xb2}))
 
-	buffer := bytes.NewBuffer(data)
+	assert.Nil(t, err, "error while decoding valid payload")
+	assert.Equal(t, packet.Payload{packet.NewBinaryMessage([]byte{0xb2})}, actual, "binary frame was not decoded properly")
+}
 
-	payload, err := codec.Decode(buffer)
+func TestWebsocketDecodeErrors(t *testing.T) {
+	tests := []struct {
+		codec codec.Websocket
+		data  []byte
+	}{
+		{codec.Websocket{}, []byte{}},
+		{codec.Websocket{}, []byte("9hello")},
+		{codec.Websocket{}, []byte{0xb2, 1}},
+		{codec.Websocket{}, []byte{2, 1}},
+		{codec.Websocket{}, []byte{'4', 0xff}},
+		{codec.Websocket{}, []byte("1closed")},
+		{codec.Websocket{BinaryFrame: true}, []byte("4hello")},
+		{codec.Websocket{Protocol: protocol.V4}, []byte{0xb2, 1}},
+		{codec.Websocket{Protocol: protocol.V4}, []byte("0")},
+	}
+
+	for _, test := range tests {
+		payload, err := test.codec.Decode(bytes.NewBuffer(test.data))
 
-	assert.Empty(t, payload, "decoded invalid payload was not empty")
-	assert.Error(t, err)
+		assert.Empty(t, payload, "decoded invalid payload was not empty")
+		assert.IsType(t, &codec.DecodeError{}, err, "decode error was expected for "+string(test.data))
+	}
 }
 
 func TestWebsocketDecodeReaderError(t *testing.T) {
@@ -127,6 +148,78 @@ func TestWebsocketDecodeReaderError(t *testing.T) {
 	assert.Error(t, err, "reader error was expected")
 }
 
+func TestWebsocketEncodeV4(t *testing.T) {
+	codec := codec.Websocket{Protocol: protocol.V4}
+
+	tests := []struct {
+		payload packet.Payload
+		encoded []byte
+	}{
+		{
+			packet.Payload{
+				packet.NewStringMessage("hello"),
+			},
+			[]byte("4hello"),
+		},
+		{
+			packet.Payload{
+				packet.NewBinaryMessage([]byte{0, 1}),
+			},
+			[]byte{0, 1},
+		},
+	}
+
+	for _, test := range tests {
+		var buffer bytes.Buffer
+
+		err := codec.Encode(test.payload, &buffer)
+
+		actual := buffer.Bytes()
+		expected := test.encoded
+
+		assert.Nil(t, err, "error while encoding valid payload")
+		assert.Equal(t, expected, actual, "payload was not encoded properly")
+	}
+}
+
+func TestWebsocketDecodeV4(t *testing.T) {
+	tests := []struct {
+		codec   codec.Websocket
+		data    []byte
+		decoded packet.Payload
+	}{
+		{
+			codec.Websocket{Protocol: protocol.V4},
+			[]byte("4hello"),
+			packet.Payload{
+				packet.NewStringMessage("hello"),
+			},
+		},
+		{
+			codec.Websocket{Protocol: protocol.V4, BinaryFrame: true},
+			[]byte("4hello"),
+			packet.Payload{
+				packet.NewBinaryMessage([]byte("4hello")),
+			},
+		},
+		{
+			codec.Websocket{Protocol: protocol.V4, BinaryFrame: true},
+			[]byte{},
+			packet.Payload{
+				packet.NewBinaryMessage([]byte{}),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		actual, err := test.codec.Decode(bytes.NewBuffer(test.data))
+		expected := test.decoded
+
+		assert.Nil(t, err, "error while decoding valid payload")
+		assert.Equal(t, expected, actual, "payload was not decoded properly")
+	}
+}
+
 func BenchmarkWebsocketEncode(b *testing.B) {
 	codec := codec.Websocket{}
 
@@ -1,69 +1,98 @@
 package codec
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/base64"
-	"errors"
 	"io"
-	"io/ioutil"
 	"strconv"
 	"unicode/utf8"
 
 	"github.com/byonchev/go-engine.io/internal/packet"
+	"github.com/byonchev/go-engine.io/internal/protocol"
 )
 
 var base64Encoding = base64.StdEncoding
 
+// recordSeparator delimits packets in protocol v4 polling payloads
+const recordSeparator = '\x1e'
+
+// maxPacketLength is the largest packet length accepted in a payload
+const maxPacketLength = int(^uint32(0) >> 1)
+
 // XHR is a codec for encoding messages for standard long polling
 type XHR struct {
 	ForceBase64 bool
+	Protocol    protocol.Version
 }
 
 // Encode encodes payload of packets for single poll
 func (codec XHR) Encode(payload packet.Payload, writer io.Writer) error {
-	if len(payload) == 0 {
-		return nil
+	var separator []byte
+
+	if codec.Protocol == protocol.V4 {
+		separator = []byte{recordSeparator}
 	}
 
-	binary := !codec.ForceBase64 && payload.ContainsBinary()
+	format, encode := codec.packetEncoder(payload)
 
-	for _, packet := range payload {
-		var err error
+	return writePackets(payload, writer, separator, format, encode)
+}
 
-		if binary {
-			err = codec.encodeBinaryPacket(packet, writer)
-		} else {
-			err = codec.encodeStringPacket(packet, writer)
-		}
+// Decode decodes payload of packets
+func (codec XHR) Decode(reader io.Reader) (packet.Payload, error) {
+	var payload packet.Payload
 
-		if err != nil {
-			return err
-		}
+	err := codec.DecodeStream(reader, func(packet packet.Packet) {
+		payload = append(payload, packet)
+	})
+
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	return payload, nil
 }
 
-// Decode decodes payload of packets
-func (codec XHR) Decode(reader io.Reader) (packet.Payload, error) {
-	encoded, err := ioutil.ReadAll(reader)
+// DecodeStream reads the payload incrementally and passes each decoded packet to the handler
+func (codec XHR) DecodeStream(reader io.Reader, handler func(packet.Packet)) error {
+	buffered := bufio.NewReader(reader)
+
+	first, err := buffered.Peek(1)
+
+	if err == io.EOF {
+		return errEmptyPayload
+	}
 
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	if len(encoded) == 0 {
-		return nil, errors.New("payload is empty")
+	if codec.Protocol == protocol.V4 {
+		return codec.streamSeparatedPayload(buffered, handler)
 	}
 
-	if encoded[0] <= 1 {
-		return codec.decodeBinaryPayload(encoded)
+	if first[0] <= 1 {
+		return codec.streamBinaryPayload(buffered, handler)
 	}
 
-	return codec.decodeStringPayload(encoded)
+	return codec.streamStringPayload(buffered, handler)
 }
 
-func (codec XHR) encodeStringPacket(packet packet.Packet, writer io.Writer) error {
+// packetEncoder selects the packet encoding depending on the protocol and the payload contents
+func (codec XHR) packetEncoder(payload packet.Payload) (packet.Format, func(packet.Packet) []byte) {
+	if codec.Protocol == protocol.V4 {
+		return xhrSeparatedFormat, codec.encodeSeparatedPacket
+	}
+
+	if !codec.ForceBase64 && payload.ContainsBinary() {
+		return xhrBinaryFormat, codec.encodeBinaryPacket
+	}
+
+	return xhrStringFormat, codec.encodeStringPacket
+}
+
+func (codec XHR) encodeStringPacket(packet packet.Packet) []byte {
 	var data []byte
 	var length int
 
@@ -81,9 +110,7 @@ func (codec XHR) encodeStringPacket(packet packet.Packet, writer io.Writer) erro
 	encoded = append(encoded, ':')
 	encoded = append(encoded, data...)
 
-	_, err := writer.Write(encoded)
-
-	return err
+	return encoded
 }
 
 func (codec XHR) encodeStringData(packet packet.Packet) []byte {
@@ -105,7 +132,20 @@ func (codec XHR) encodeBase64Data(packet packet.Packet) []byte {
 	return buffer.Bytes()
 }
 
-func (codec XHR) encodeBinaryPacket(packet packet.Packet, writer io.Writer) error {
+func (codec XHR) encodeSeparatedPacket(packet packet.Packet) []byte {
+	if !packet.Binary {
+		return codec.encodeStringData(packet)
+	}
+
+	encoded := make([]byte, base64Encoding.EncodedLen(len(packet.Data))+1)
+
+	encoded[0] = 'b'
+	base64Encoding.Encode(encoded[1:], packet.Data)
+
+	return encoded
+}
+
+func (codec XHR) encodeBinaryPacket(packet packet.Packet) []byte {
 	var messageType byte
 	var packetType byte
 
@@ -133,96 +173,219 @@ func (codec XHR) encodeBinaryPacket(packet packet.Packet, writer io.Writer) erro
 	encoded = append(encoded, packetType)
 	encoded = append(encoded, packet.Data...)
 
-	_, err := writer.Write(encoded)
+	return encoded
+}
+
+func (codec XHR) decodeSeparatedPacket(record []byte) (packet.Packet, error) {
+	if len(record) < 1 {
+		return packet.Packet{}, newDecodeError("invalid packet")
+	}
 
-	return err
+	if record[0] != 'b' {
+		return packet.Packet{
+			Binary: false,
+			Type:   packet.TypeFromChar(record[0]),
+			Data:   record[1:],
+		}, nil
+	}
+
+	decoded, err := base64Encoding.DecodeString(string(record[1:]))
+
+	if err != nil {
+		return packet.Packet{}, newDecodeError("base64 decoding error: " + err.Error())
+	}
+
+	return packet.NewBinaryMessage(decoded), nil
 }
 
-func (codec XHR) decodeStringPayload(data []byte) (packet.Payload, error) {
-	var payload packet.Payload
-	var lengthRunes []rune
+func (codec XHR) streamStringPayload(reader *bufio.Reader, handler func(packet.Packet)) error {
+	for {
+		length, err := readLength(reader, ':', '0')
 
-	runes := []rune(string(data))
-	total := len(runes)
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
 
-	for i := 0; i < total; i++ {
-		r := runes[i]
+		data, err := readRunes(reader, length)
 
-		if r != ':' {
-			lengthRunes = append(lengthRunes, r)
-			continue
+		if err != nil {
+			return err
 		}
 
-		length, err := strconv.Atoi(string(lengthRunes))
+		packet, err := validatePacket(codec.decodeStringPacket(data))
 
 		if err != nil {
-			return nil, errors.New("invalid packet length")
+			return err
+		}
+
+		handler(packet)
+	}
+}
+
+func (codec XHR) streamSeparatedPayload(reader *bufio.Reader, handler func(packet.Packet)) error {
+	for {
+		record, err := reader.ReadBytes(recordSeparator)
+
+		if err != nil && err != io.EOF {
+			return err
 		}
 
-		start := i + 1
-		end := start + length
+		last := err == io.EOF
 
-		if end > total {
-			return nil, errors.New("packet length overflow")
+		if !last {
+			record = record[:len(record)-1]
 		}
 
-		packet, err := codec.decodeStringPacket([]byte(string(runes[start:end])))
+		packet, err := validatePacket(codec.decodeSeparatedPacket(record))
 
 		if err != nil {
-			return nil, err
+			return err
 		}
 
-		payload = append(payload, packet)
+		handler(packet)
 
-		lengthRunes = nil
-		i = end - 1
+		if last {
+			return nil
+		}
 	}
-
-	return payload, nil
 }
 
-func (codec XHR) decodeBinaryPayload(data []byte) (packet.Payload, error) {
-	var payload packet.Payload
+func (codec XHR) streamBinaryPayload(reader *bufio.Reader, handler func(packet.Packet)) error {
+	for {
+		messageType, err := reader.ReadByte()
 
-	total := len(data)
+		if err == io.EOF {
+			return nil
+		}
 
-	for offset := 0; offset < total-1; {
-		messageType := data[offset]
+		if err != nil {
+			return err
+		}
 
-		offset++
+		length, err := readLength(reader, 255, 0)
 
-		length := 0
+		if err == io.EOF {
+			return newDecodeError("invalid packet length")
+		}
 
-		for offset < total && data[offset] != 255 {
-			length = length*10 + int(data[offset])
-			offset++
+		if err != nil {
+			return err
 		}
 
-		offset++
+		var data bytes.Buffer
+
+		_, err = io.CopyN(&data, reader, int64(length))
 
-		start := offset
-		end := offset + length
+		if err == io.EOF {
+			return newDecodeError("packet length overflow")
+		}
 
-		if end > total {
-			return nil, errors.New("packet length overflow")
+		if err != nil {
+			return err
 		}
 
-		packet, err := codec.decodeBinaryPacket(messageType, data[start:end])
+		packet, err := validatePacket(codec.decodeBinaryPacket(messageType, data.Bytes()))
 
 		if err != nil {
+			return err
+		}
+
+		handler(packet)
+	}
+}
+
+// readLength reads decimal packet length terminated by the delimiter.
+// Digits are encoded as offsets from zero. io.EOF is returned only if the reader is exhausted
+func readLength(reader *bufio.Reader, delimiter byte, zero byte) (int, error) {
+	length := 0
+	digits := 0
+
+	for {
+		b, err := reader.ReadByte()
+
+		if err == io.EOF && digits == 0 {
+			return 0, io.EOF
+		}
+
+		if err == io.EOF {
+			return 0, newDecodeError("invalid packet length")
+		}
+
+		if err != nil {
+			return 0, err
+		}
+
+		if b == delimiter && digits > 0 {
+			return length, nil
+		}
+
+		digit := int(b) - int(zero)
+
+		if digit < 0 || digit > 9 || length > (maxPacketLength-digit)/10 {
+			return 0, newDecodeError("invalid packet length")
+		}
+
+		length = length*10 + digit
+		digits++
+	}
+}
+
+// readRunes reads the data of a packet which length is counted in characters.
+// Invalid UTF-8 bytes are counted as single characters and kept as they are
+func readRunes(reader *bufio.Reader, count int) ([]byte, error) {
+	var data bytes.Buffer
+
+	required := 1
+
+	for count > 0 {
+		_, err := reader.Peek(required)
+
+		eof := err == io.EOF
+
+		if err != nil && !eof {
 			return nil, err
 		}
 
-		payload = append(payload, packet)
-		offset += length
+		buffered, _ := reader.Peek(reader.Buffered())
+
+		if len(buffered) == 0 {
+			return nil, newDecodeError("packet length overflow")
+		}
+
+		n := 0
+
+		for count > 0 && n < len(buffered) && (eof || utf8.FullRune(buffered[n:])) {
+			_, size := utf8.DecodeRune(buffered[n:])
+
+			n += size
+			count--
+		}
+
+		// wait for the remaining bytes of an incomplete character
+		required = 1
+
+		if n == 0 {
+			required = len(buffered) + 1
+		}
+
+		data.Write(buffered[:n])
+		reader.Discard(n)
 	}
 
-	return payload, nil
+	return data.Bytes(), nil
 }
 
 func (codec XHR) decodeBinaryPacket(messageType byte, data []byte) (packet.Packet, error) {
+	if messageType > 1 {
+		return packet.Packet{}, newDecodeError("invalid message type")
+	}
+
 	if len(data) < 1 {
-		return packet.Packet{}, errors.New("invalid packet")
+		return packet.Packet{}, newDecodeError("invalid packet")
 	}
 
 	var binary bool
@@ -247,7 +410,7 @@ func (codec XHR) decodeBinaryPacket(messageType byte, data []byte) (packet.Packe
 
 func (codec XHR) decodeStringPacket(data []byte) (packet.Packet, error) {
 	if len(data) < 1 {
-		return packet.Packet{}, errors.New("invalid packet")
+		return packet.Packet{}, newDecodeError("invalid packet")
 	}
 
 	if data[0] == 'b' {
@@ -266,13 +429,13 @@ func (codec XHR) decodeBase64Packet(data []byte) (packet.Packet, error) {
 	var err error
 
 	if len(data) < 1 {
-		return packet.Packet{}, errors.New("invalid packet")
+		return packet.Packet{}, newDecodeError("invalid packet")
 	}
 
 	decoded, err = base64Encoding.DecodeString(string(data[1:]))
 
 	if err != nil {
-		return packet.Packet{}, errors.New("base64 decoding error: " + err.Error())
+		return packet.Packet{}, newDecodeError("base64 decoding error: " + err.Error())
 	}
 
 	return packet.Packet{
@@ -0,0 +1,115 @@
+package codec_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/byonchev/go-engine.io/internal/codec"
+	"github.com/byonchev/go-engine.io/internal/packet"
+	"github.com/byonchev/go-engine.io/internal/protocol"
+	"github.com/stretchr/testify/assert"
+)
+
+var xhrSeeds = [][]byte{
+	[]byte("8:4hello ❤"),
+	[]byte("6:4hello6:4world6:3probe"),
+	[]byte("1:16:b4Kg=="),
+	[]byte("4hello\x1e4world\x1ebKg=="),
+	[]byte{1, 4, 255, 4, 2, 4, 8, 0, 1, 0, 255, '4', 'H', 'e', 'l', 'l', 'o', 0xf0, 0x9f, 0x91, 0x8b},
+	[]byte("99999999999999999999:4"),
+	[]byte{0, 9, 9, 9, 9, 9, 9, 9, 9, 255, '4'},
+}
+
+func FuzzXHRDecode(f *testing.F) {
+	for _, seed := range xhrSeeds {
+		f.Add(seed, false)
+		f.Add(seed, true)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte, v4 bool) {
+		xhr := codec.XHR{}
+
+		if v4 {
+			xhr.Protocol = protocol.V4
+		}
+
+		payload, err := xhr.Decode(bytes.NewReader(data))
+
+		if err != nil {
+			assert.Empty(t, payload, "payload was decoded with error")
+			return
+		}
+
+		var buffer bytes.Buffer
+
+		xhr.Encode(payload, &buffer)
+
+		decoded, err := xhr.Decode(&buffer)
+
+		assert.Nil(t, err, "error while decoding encoded payload")
+		assert.Equal(t, payload, decoded, "decoded payload was not encoded properly")
+	})
+}
+
+func FuzzXHRDecodeStream(f *testing.F) {
+	for _, seed := range xhrSeeds {
+		f.Add(seed, false)
+		f.Add(seed, true)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte, v4 bool) {
+		xhr := codec.XHR{}
+
+		if v4 {
+			xhr.Protocol = protocol.V4
+		}
+
+		xhr.DecodeStream(bytes.NewReader(data), func(packet.Packet) {})
+	})
+}
+
+func FuzzXHRStreamRoundTrip(f *testing.F) {
+	f.Add("hello", []byte{1, 2, 3})
+	f.Add("hello ❤ wörld 👋", []byte{})
+	f.Add("6:4hello", []byte("\x1e"))
+
+	f.Fuzz(func(t *testing.T, text string, binary []byte) {
+		if !utf8.ValidString(text) {
+			return
+		}
+
+		payload := packet.Payload{
+			packet.NewStringMessage(text),
+			packet.NewBinaryMessage(binary),
+			packet.NewPing([]byte(text)),
+		}
+
+		codecs := []codec.XHR{
+			{},
+			{ForceBase64: true},
+		}
+
+		if !strings.ContainsRune(text, '\x1e') {
+			codecs = append(codecs, codec.XHR{Protocol: protocol.V4})
+		}
+
+		for _, xhr := range codecs {
+			var buffer bytes.Buffer
+
+			xhr.Encode(payload, &buffer)
+
+			decoded, err := decodeStream(xhr, buffer.Bytes())
+
+			assert.Nil(t, err, "error while stream decoding encoded payload")
+			assert.Equal(t, len(payload), len(decoded), "wrong number of decoded packets")
+
+			for i := range decoded {
+				assert.Equal(t, payload[i].Binary, decoded[i].Binary, "packet kind was not preserved")
+				assert.Equal(t, payload[i].Type, decoded[i].Type, "packet type was not preserved")
+				assert.True(t, bytes.Equal(payload[i].Data, decoded[i].Data), "packet data was not preserved")
+			}
+		}
+	})
+}
@@ -2,13 +2,29 @@ package codec_test
 
 import (
 	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/byonchev/go-engine.io/internal/codec"
 	"github.com/byonchev/go-engine.io/internal/packet"
+	"github.com/byonchev/go-engine.io/internal/protocol"
 	"github.com/stretchr/testify/assert"
 )
 
+func decodeStream(codec codec.XHR, data []byte) (packet.Payload, error) {
+	var payload packet.Payload
+
+	err := codec.DecodeStream(bytes.NewBuffer(data), func(packet packet.Packet) {
+		payload = append(payload, packet)
+	})
+
+	return payload, err
+}
+
 func TestXHREncode(t *testing.T) {
 	codec := codec.XHR{}
 
@@ -130,6 +146,11 @@ func TestXHRDecode(t *testing.T) {
 
 		assert.Nil(t, err, "error while decoding valid payload")
 		assert.Equal(t, expected, actual, "payload was not decoded properly")
+
+		streamed, err := decodeStream(codec, test.data)
+
+		assert.Nil(t, err, "error while stream decoding valid payload")
+		assert.Equal(t, expected, streamed, "payload was not stream decoded properly")
 	}
 }
 
@@ -145,6 +166,17 @@ func TestXHRDecodeErrors(t *testing.T) {
 		[]byte{},
 		[]byte{1, 5, 255, 4},
 		[]byte{1, 0, 255},
+		[]byte("-1:4"),
+		[]byte("+6:4hello"),
+		[]byte("6:4hello0"),
+		[]byte{0, 9, 9, 9, 9, 9, 9, 9, 9, 9, 9, 9, 9, 9, 9, 9, 9, 9, 9, 9, 255, 4},
+		[]byte{0, 1, 2, 255, 4},
+		[]byte{0, 2, 255, '4', 'a', 7, 2, 255, '4', 'b'},
+		[]byte("6:9hello"),
+		[]byte("2:1x"),
+		[]byte("1:0"),
+		[]byte{0, 3, 255, '4', 0xc3, 0x28},
+		[]byte{1, 2, 255, 2, 1},
 	}
 
 	for _, test := range tests {
@@ -152,6 +184,10 @@ func TestXHRDecodeErrors(t *testing.T) {
 
 		assert.Empty(t, payload, "decoded invalid payload was not empty")
 		assert.Error(t, err, "error was expected for decoding "+string(test))
+
+		_, err = decodeStream(codec, test)
+
+		assert.Error(t, err, "error was expected for stream decoding "+string(test))
 	}
 }
 
@@ -161,6 +197,155 @@ func TestXHRDecodeReaderError(t *testing.T) {
 	_, err := codec.Decode(errorReader{})
 
 	assert.Error(t, err, "reader error was expected")
+
+	err = codec.DecodeStream(errorReader{}, func(packet.Packet) {})
+
+	assert.Error(t, err, "reader error was expected while streaming")
+}
+
+func TestXHRDecodeStreamPartial(t *testing.T) {
+	tests := []struct {
+		codec   codec.XHR
+		data    []byte
+		decoded packet.Payload
+	}{
+		{
+			codec.XHR{},
+			[]byte("6:4hello2:4"),
+			packet.Payload{packet.NewStringMessage("hello")},
+		},
+		{
+			codec.XHR{},
+			[]byte{0, 6, 255, '4', 'h', 'e', 'l', 'l', 'o', 1, 9, 255, 4},
+			packet.Payload{packet.NewStringMessage("hello")},
+		},
+		{
+			codec.XHR{Protocol: protocol.V4},
+			[]byte("4hello\x1ebINVALID_BASE64"),
+			packet.Payload{packet.NewStringMessage("hello")},
+		},
+	}
+
+	for _, test := range tests {
+		payload, err := decodeStream(test.codec, test.data)
+
+		assert.Error(t, err, "error was expected for stream decoding "+string(test.data))
+		assert.Equal(t, test.decoded, payload, "packets preceding the error were not passed")
+	}
+}
+
+func TestXHREncodeV4(t *testing.T) {
+	codec := codec.XHR{Protocol: protocol.V4}
+
+	tests := []struct {
+		payload packet.Payload
+		encoded string
+	}{
+		{
+			packet.Payload{},
+			"",
+		},
+		{
+			packet.Payload{
+				packet.NewStringMessage("utf八 string"),
+			},
+			"4utf八 string",
+		},
+		{
+			packet.Payload{
+				packet.NewOpen([]byte("hello")),
+				packet.NewStringMessage("world"),
+			},
+			"0hello\x1e4world",
+		},
+		{
+			packet.Payload{
+				packet.NewBinaryMessage([]byte{2, 4, 8}),
+				packet.NewPing(nil),
+			},
+			"bAgQI\x1e2",
+		},
+	}
+
+	for _, test := range tests {
+		var buffer bytes.Buffer
+
+		err := codec.Encode(test.payload, &buffer)
+
+		actual := buffer.String()
+		expected := test.encoded
+
+		assert.Nil(t, err, "error while encoding payload")
+		assert.Equal(t, expected, actual, "payload was not encoded propery")
+	}
+}
+
+func TestXHRDecodeV4(t *testing.T) {
+	codec := codec.XHR{Protocol: protocol.V4}
+
+	tests := []struct {
+		data    []byte
+		decoded packet.Payload
+	}{
+		{
+			[]byte("4hello \u2764"),
+			packet.Payload{
+				packet.NewStringMessage("hello ❤"),
+			},
+		},
+		{
+			[]byte("4hello\x1e4world\x1e3probe"),
+			packet.Payload{
+				packet.NewStringMessage("hello"),
+				packet.NewStringMessage("world"),
+				packet.NewPong([]byte("probe")),
+			},
+		},
+		{
+			[]byte("1\x1ebKg=="),
+			packet.Payload{
+				packet.NewClose(),
+				packet.NewBinaryMessage([]byte{42}),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		actual, err := codec.Decode(bytes.NewBuffer(test.data))
+		expected := test.decoded
+
+		assert.Nil(t, err, "error while decoding valid payload")
+		assert.Equal(t, expected, actual, "payload was not decoded properly")
+
+		streamed, err := decodeStream(codec, test.data)
+
+		assert.Nil(t, err, "error while stream decoding valid payload")
+		assert.Equal(t, expected, streamed, "payload was not stream decoded properly")
+	}
+}
+
+func TestXHRDecodeErrorsV4(t *testing.T) {
+	codec := codec.XHR{Protocol: protocol.V4}
+
+	tests := [][]byte{
+		[]byte{},
+		[]byte("4hello\x1e"),
+		[]byte("\x1e4hello"),
+		[]byte("bINVALID_BASE64"),
+		[]byte("4hello\x1e9world"),
+		[]byte("4\xff"),
+	}
+
+	for _, test := range tests {
+		payload, err := codec.Decode(bytes.NewBuffer(test))
+
+		assert.Empty(t, payload, "decoded invalid payload was not empty")
+		assert.Error(t, err, "error was expected for decoding "+string(test))
+
+		_, err = decodeStream(codec, test)
+
+		assert.Error(t, err, "error was expected for stream decoding "+string(test))
+	}
 }
 
 func BenchmarkXHREncodeString(b *testing.B) {
@@ -207,6 +392,114 @@ func BenchmarkXHRDecodeString(b *testing.B) {
 	}
 }
 
+func TestXHRDecodeBufferedBaseline(t *testing.T) {
+	data := largeStringPayload()
+
+	expected, _ := codec.XHR{}.Decode(bytes.NewReader(data))
+	actual, err := decodeBuffered(bytes.NewReader(data))
+
+	assert.Nil(t, err, "baseline did not decode payload")
+	assert.Equal(t, expected, actual, "baseline decoded payload differently")
+}
+
+func BenchmarkXHRDecodeBufferedLargeString(b *testing.B) {
+	data := largeStringPayload()
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+
+	for n := 0; n < b.N; n++ {
+		decodeBuffered(bytes.NewReader(data))
+	}
+}
+
+func BenchmarkXHRDecodeLargeString(b *testing.B) {
+	codec := codec.XHR{}
+
+	data := largeStringPayload()
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+
+	for n := 0; n < b.N; n++ {
+		codec.Decode(bytes.NewReader(data))
+	}
+}
+
+func BenchmarkXHRDecodeStreamLargeString(b *testing.B) {
+	codec := codec.XHR{}
+
+	data := largeStringPayload()
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+
+	for n := 0; n < b.N; n++ {
+		codec.DecodeStream(bytes.NewReader(data), func(packet.Packet) {})
+	}
+}
+
+// decodeBuffered mirrors the string payload decoder used before payloads were streamed.
+// It reads the whole payload first and is kept as a benchmark baseline
+func decodeBuffered(reader io.Reader) (packet.Payload, error) {
+	encoded, err := ioutil.ReadAll(reader)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var payload packet.Payload
+	var lengthRunes []rune
+
+	runes := []rune(string(encoded))
+	total := len(runes)
+
+	for i := 0; i < total; i++ {
+		r := runes[i]
+
+		if r != ':' {
+			lengthRunes = append(lengthRunes, r)
+			continue
+		}
+
+		length, err := strconv.Atoi(string(lengthRunes))
+
+		if err != nil {
+			return nil, errors.New("invalid packet length")
+		}
+
+		start := i + 1
+		end := start + length
+
+		if end > total || length < 1 {
+			return nil, errors.New("invalid packet")
+		}
+
+		data := []byte(string(runes[start:end]))
+
+		payload = append(payload, packet.Packet{Type: packet.TypeFromChar(data[0]), Data: data[1:]})
+
+		lengthRunes = nil
+		i = end - 1
+	}
+
+	return payload, nil
+}
+
+func largeStringPayload() []byte {
+	var payload packet.Payload
+
+	for i := 0; i < 100; i++ {
+		payload = append(payload, packet.NewStringMessage(strings.Repeat("hello wörld ❤ ", 100)))
+	}
+
+	var buffer bytes.Buffer
+
+	codec.XHR{ForceBase64: true}.Encode(payload, &buffer)
+
+	return buffer.Bytes()
+}
+
 func BenchmarkXHRDecodeBinary(b *testing.B) {
 	codec := codec.XHR{}
 
@@ -3,24 +3,35 @@ package config
 import (
 	"net/http"
 	"time"
+
+	"github.com/byonchev/go-engine.io/internal/dispatch"
 )
 
 // Config holds the configuration for a single session
 type Config struct {
-	// Expected interval for receiving ping packets from client
+	// Expected interval for receiving ping packets from protocol v3 clients
+	// and for sending ping packets to protocol v4 clients
 	PingInterval time.Duration
 
-	// After no ping is received for PingInterval + PingTimeout,
+	// After no ping is received from protocol v3 clients for PingInterval + PingTimeout,
+	// or no pong is received from protocol v4 clients for PingTimeout after a ping,
 	// the session is considered to be expired
 	PingTimeout time.Duration
 
 	// List of supported transports
 	Transports []string
 
+	// Maximum size in bytes of a polling request body, a websocket message
+	// or a packet received over a stream transport.
+	// Larger payloads close the session. Non-positive value means no limit.
+	// The limit is advertised to protocol v4 clients as maxPayload
+	MaxHTTPBufferSize int64
+
 	// Whether to allow transport upgrades or not
 	AllowUpgrades bool
 
-	// Maximum time to wait for uncompleted upgrade
+	// Maximum time to wait for the probe and upgrade packets
+	// before the upgrade is aborted and the client stays on polling
 	UpgradeTimeout time.Duration
 
 	// Maximum buffered packets to be flushed
@@ -37,13 +48,40 @@ type Config struct {
 	// Websocket I/O write buffer size
 	WebsocketWriteBufferSize int
 
-	// Whether to enable gzip on polling transport or not
-	// HTTPCompression bool
+	// Whether to compress polling responses with gzip or deflate
+	// depending on the Accept-Encoding request header
+	HTTPCompression bool
+
+	// Minimum size in bytes of polling responses to be compressed
+	HTTPCompressionThreshold int
+
+	// Websocket permessage-deflate extension settings
+	PerMessageDeflate PerMessageDeflate
+
+	// Maximum received messages waiting to be handled by a single socket.
+	// Non-positive value means no limit
+	EventQueueSize int
 
-	// Whether to enable websocket permessage-deflate extension or not
-	PerMessageDeflate bool
+	// What to do when a message is received while the socket event queue is full
+	EventQueueOverflow dispatch.Policy
 
 	// Function used by transports to validate request
 	// and prevent cross-site request forgery
 	CheckOrigin func(*http.Request) bool
 }
+
+// PerMessageDeflate holds the settings of the websocket permessage-deflate extension.
+// Context takeover is not supported: the websocket library always negotiates
+// server_no_context_takeover and client_no_context_takeover,
+// so every message is compressed with a new context
+type PerMessageDeflate struct {
+	// Whether to negotiate the extension or not
+	Enabled bool
+
+	// Minimum size in bytes of messages to be compressed
+	Threshold int
+
+	// Compression level between flate.BestSpeed and flate.BestCompression.
+	// Default level is used if not set
+	Level int
+}
@@ -0,0 +1,196 @@
+package dispatch
+
+import (
+	"errors"
+	"sync"
+)
+
+// Policy defines what happens when a bounded task is pushed to a full queue
+type Policy int
+
+// Supported overflow policies
+const (
+	// Block waits until there is space in the queue
+	Block Policy = iota
+
+	// DropOldest discards the oldest pending bounded task
+	DropOldest
+
+	// Reject refuses the task and returns ErrOverflow
+	Reject
+)
+
+// Errors returned when pushing tasks
+var (
+	ErrClosed   = errors.New("queue closed")
+	ErrOverflow = errors.New("queue overflow")
+)
+
+// Queue runs pushed tasks one at a time in the order they were pushed.
+// A goroutine is running only while there are pending tasks
+type Queue struct {
+	sync.Mutex
+
+	capacity int
+	policy   Policy
+
+	pending []entry
+	bounded int
+
+	spaceCondition *sync.Cond
+
+	running bool
+	closed  bool
+
+	done     chan struct{}
+	finished bool
+}
+
+type entry struct {
+	task    func()
+	bounded bool
+}
+
+// NewQueue creates an empty task queue. Non-positive capacity makes the queue unbounded
+func NewQueue(capacity int, policy Policy) *Queue {
+	queue := &Queue{
+		capacity: capacity,
+		policy:   policy,
+		done:     make(chan struct{}),
+	}
+
+	queue.spaceCondition = sync.NewCond(queue)
+
+	return queue
+}
+
+// Push enqueues task for execution, applying the overflow policy if the queue is full
+func (queue *Queue) Push(task func()) error {
+	queue.Lock()
+	defer queue.Unlock()
+
+	for !queue.closed && queue.full() {
+		switch queue.policy {
+		case Block:
+			queue.spaceCondition.Wait()
+		case DropOldest:
+			queue.dropOldest()
+		default:
+			return ErrOverflow
+		}
+	}
+
+	return queue.enqueue(entry{task, true})
+}
+
+// Force enqueues task for execution regardless of the queue capacity
+func (queue *Queue) Force(task func()) error {
+	queue.Lock()
+	defer queue.Unlock()
+
+	return queue.enqueue(entry{task, false})
+}
+
+// Close stops accepting new tasks. Already pushed tasks are still executed
+func (queue *Queue) Close() {
+	queue.Lock()
+	defer queue.Unlock()
+
+	queue.closed = true
+
+	queue.spaceCondition.Broadcast()
+
+	if !queue.running {
+		queue.finish()
+	}
+}
+
+// Done returns a channel which is closed after the queue is closed and all pushed tasks are executed
+func (queue *Queue) Done() <-chan struct{} {
+	return queue.done
+}
+
+func (queue *Queue) full() bool {
+	return queue.capacity > 0 && queue.bounded >= queue.capacity
+}
+
+func (queue *Queue) enqueue(pending entry) error {
+	if queue.closed {
+		return ErrClosed
+	}
+
+	queue.pending = append(queue.pending, pending)
+
+	if pending.bounded {
+		queue.bounded++
+	}
+
+	if !queue.running {
+		queue.running = true
+
+		go queue.run()
+	}
+
+	return nil
+}
+
+func (queue *Queue) dropOldest() {
+	for i, pending := range queue.pending {
+		if pending.bounded {
+			queue.pending = append(queue.pending[:i], queue.pending[i+1:]...)
+			queue.bounded--
+
+			return
+		}
+	}
+}
+
+func (queue *Queue) finish() {
+	if queue.finished {
+		return
+	}
+
+	queue.finished = true
+
+	close(queue.done)
+}
+
+func (queue *Queue) run() {
+	for {
+		task, ok := queue.next()
+
+		if !ok {
+			return
+		}
+
+		task()
+	}
+}
+
+func (queue *Queue) next() (func(), bool) {
+	queue.Lock()
+	defer queue.Unlock()
+
+	if len(queue.pending) == 0 {
+		queue.running = false
+
+		if queue.closed {
+			queue.finish()
+		}
+
+		return nil, false
+	}
+
+	next := queue.pending[0]
+
+	queue.pending[0] = entry{}
+	queue.pending = queue.pending[1:]
+
+	if next.bounded {
+		queue.bounded--
+
+		queue.spaceCondition.Signal()
+	}
+
+	return next.task, true
+}
@@ -0,0 +1,239 @@
+package dispatch_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/byonchev/go-engine.io/internal/dispatch"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueueOrder(t *testing.T) {
+	queue := dispatch.NewQueue(0, dispatch.Block)
+
+	var actual []int
+	var expected []int
+
+	var wait sync.WaitGroup
+
+	for i := 0; i < 100; i++ {
+		i := i
+
+		expected = append(expected, i)
+
+		wait.Add(1)
+
+		queue.Push(func() {
+			if i%10 == 0 {
+				time.Sleep(time.Millisecond)
+			}
+
+			actual = append(actual, i)
+
+			wait.Done()
+		})
+	}
+
+	wait.Wait()
+
+	assert.Equal(t, expected, actual, "tasks were not executed in order")
+}
+
+func TestQueueSequential(t *testing.T) {
+	queue := dispatch.NewQueue(0, dispatch.Block)
+
+	var running int
+	var lock sync.Mutex
+
+	var wait sync.WaitGroup
+
+	for i := 0; i < 10; i++ {
+		wait.Add(1)
+
+		queue.Push(func() {
+			lock.Lock()
+			running++
+			assert.Equal(t, 1, running, "tasks were executed concurrently")
+			lock.Unlock()
+
+			time.Sleep(time.Millisecond)
+
+			lock.Lock()
+			running--
+			lock.Unlock()
+
+			wait.Done()
+		})
+	}
+
+	wait.Wait()
+}
+
+func TestQueueClose(t *testing.T) {
+	queue := dispatch.NewQueue(0, dispatch.Block)
+
+	executed := make(chan struct{}, 1)
+
+	assert.NoError(t, queue.Push(func() { executed <- struct{}{} }), "task was not pushed")
+
+	queue.Close()
+
+	assert.Equal(t, dispatch.ErrClosed, queue.Push(func() { t.Error("task was executed after close") }), "task was pushed after close")
+	assert.Equal(t, dispatch.ErrClosed, queue.Force(func() { t.Error("task was executed after close") }), "task was forced after close")
+
+	select {
+	case <-executed:
+	case <-time.After(time.Second):
+		t.Error("task pushed before close was not executed")
+	}
+}
+
+func TestQueueDone(t *testing.T) {
+	queue := dispatch.NewQueue(0, dispatch.Block)
+
+	release := make(chan struct{})
+
+	blockQueue(queue, release)
+
+	queue.Close()
+	queue.Close()
+
+	select {
+	case <-queue.Done():
+		t.Error("queue was done before pending tasks were executed")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+
+	select {
+	case <-queue.Done():
+	case <-time.After(time.Second):
+		t.Error("queue was not done after pending tasks were executed")
+	}
+}
+
+func TestQueueDoneEmpty(t *testing.T) {
+	queue := dispatch.NewQueue(0, dispatch.Block)
+
+	queue.Close()
+
+	select {
+	case <-queue.Done():
+	case <-time.After(time.Second):
+		t.Error("empty queue was not done after close")
+	}
+}
+
+func TestQueueBlock(t *testing.T) {
+	queue := dispatch.NewQueue(1, dispatch.Block)
+
+	release := make(chan struct{})
+	pushed := make(chan struct{})
+
+	blockQueue(queue, release)
+	queue.Push(func() {})
+
+	go func() {
+		queue.Push(func() {})
+		close(pushed)
+	}()
+
+	select {
+	case <-pushed:
+		t.Error("push to full queue was not blocked")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+
+	select {
+	case <-pushed:
+	case <-time.After(time.Second):
+		t.Error("blocked push was not released")
+	}
+}
+
+func TestQueueBlockClose(t *testing.T) {
+	queue := dispatch.NewQueue(1, dispatch.Block)
+
+	release := make(chan struct{})
+	defer close(release)
+
+	blockQueue(queue, release)
+	queue.Push(func() {})
+
+	result := make(chan error)
+
+	go func() {
+		result <- queue.Push(func() {})
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+
+	queue.Close()
+
+	select {
+	case err := <-result:
+		assert.Equal(t, dispatch.ErrClosed, err, "blocked push was not rejected after close")
+	case <-time.After(time.Second):
+		t.Error("blocked push was not released on close")
+	}
+}
+
+func TestQueueDropOldest(t *testing.T) {
+	queue := dispatch.NewQueue(2, dispatch.DropOldest)
+
+	release := make(chan struct{})
+
+	var actual []int
+	var wait sync.WaitGroup
+
+	wait.Add(1)
+
+	blockQueue(queue, release)
+	queue.Force(func() { actual = append(actual, 0) })
+
+	for i := 1; i <= 4; i++ {
+		i := i
+
+		queue.Push(func() {
+			actual = append(actual, i)
+
+			if i == 4 {
+				wait.Done()
+			}
+		})
+	}
+
+	close(release)
+	wait.Wait()
+
+	assert.Equal(t, []int{0, 3, 4}, actual, "oldest bounded tasks were not dropped")
+}
+
+func TestQueueReject(t *testing.T) {
+	queue := dispatch.NewQueue(1, dispatch.Reject)
+
+	release := make(chan struct{})
+	defer close(release)
+
+	blockQueue(queue, release)
+
+	assert.NoError(t, queue.Push(func() {}), "task was not pushed")
+
+	assert.Equal(t, dispatch.ErrOverflow, queue.Push(func() {}), "task was pushed to full queue")
+	assert.NoError(t, queue.Force(func() {}), "forced task was rejected")
+}
+
+func blockQueue(queue *dispatch.Queue, release <-chan struct{}) {
+	started := make(chan struct{})
+
+	queue.Push(func() {
+		close(started)
+		<-release
+	})
+
+	<-started
+}
@@ -0,0 +1,232 @@
+package heartbeat
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// Scheduler runs delayed callbacks for any number of timers
+// using a single goroutine and a min-heap ordered by deadline
+type Scheduler struct {
+	sync.Mutex
+
+	queue timerQueue
+
+	wakeup chan struct{}
+	done   chan struct{}
+
+	stopped bool
+}
+
+// Timer is a single callback managed by a scheduler
+type Timer struct {
+	scheduler *Scheduler
+	callback  func()
+	deadline  time.Time
+	index     int
+}
+
+// NewScheduler creates a scheduler and starts its goroutine
+func NewScheduler() *Scheduler {
+	scheduler := &Scheduler{
+		wakeup: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+
+	go scheduler.run()
+
+	return scheduler
+}
+
+// NewTimer creates a timer which is not scheduled until reset
+func (scheduler *Scheduler) NewTimer(callback func()) *Timer {
+	return &Timer{
+		scheduler: scheduler,
+		callback:  callback,
+		index:     -1,
+	}
+}
+
+// AfterFunc schedules a callback to be called in its own goroutine after the delay
+func (scheduler *Scheduler) AfterFunc(delay time.Duration, callback func()) *Timer {
+	timer := scheduler.NewTimer(callback)
+	timer.Reset(delay)
+
+	return timer
+}
+
+// Stop cancels all scheduled timers and stops the scheduler goroutine
+func (scheduler *Scheduler) Stop() {
+	scheduler.Lock()
+	defer scheduler.Unlock()
+
+	if scheduler.stopped {
+		return
+	}
+
+	scheduler.stopped = true
+
+	for _, timer := range scheduler.queue {
+		timer.index = -1
+	}
+
+	scheduler.queue = nil
+
+	close(scheduler.done)
+}
+
+// Stopped reports whether the scheduler was stopped
+func (scheduler *Scheduler) Stopped() bool {
+	scheduler.Lock()
+	defer scheduler.Unlock()
+
+	return scheduler.stopped
+}
+
+// Len returns the number of scheduled timers
+func (scheduler *Scheduler) Len() int {
+	scheduler.Lock()
+	defer scheduler.Unlock()
+
+	return len(scheduler.queue)
+}
+
+// Reset schedules the timer to fire after the delay, replacing the previous deadline
+func (timer *Timer) Reset(delay time.Duration) {
+	scheduler := timer.scheduler
+
+	scheduler.Lock()
+
+	if scheduler.stopped {
+		scheduler.Unlock()
+		return
+	}
+
+	timer.deadline = time.Now().Add(delay)
+
+	if timer.index < 0 {
+		heap.Push(&scheduler.queue, timer)
+	} else {
+		heap.Fix(&scheduler.queue, timer.index)
+	}
+
+	first := timer.index == 0
+
+	scheduler.Unlock()
+
+	if first {
+		scheduler.notify()
+	}
+}
+
+// Stop cancels the timer. Returns false if the timer was not scheduled
+func (timer *Timer) Stop() bool {
+	scheduler := timer.scheduler
+
+	scheduler.Lock()
+	defer scheduler.Unlock()
+
+	if timer.index < 0 {
+		return false
+	}
+
+	heap.Remove(&scheduler.queue, timer.index)
+
+	return true
+}
+
+func (scheduler *Scheduler) run() {
+	for {
+		wait, scheduled := scheduler.fireExpired()
+
+		var deadline <-chan time.Time
+		var timer *time.Timer
+
+		if scheduled {
+			timer = time.NewTimer(wait)
+			deadline = timer.C
+		}
+
+		select {
+		case <-deadline:
+		case <-scheduler.wakeup:
+		case <-scheduler.done:
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+
+		select {
+		case <-scheduler.done:
+			return
+		default:
+		}
+	}
+}
+
+func (scheduler *Scheduler) fireExpired() (time.Duration, bool) {
+	scheduler.Lock()
+	defer scheduler.Unlock()
+
+	now := time.Now()
+
+	for len(scheduler.queue) > 0 {
+		next := scheduler.queue[0]
+		wait := next.deadline.Sub(now)
+
+		if wait > 0 {
+			return wait, true
+		}
+
+		heap.Pop(&scheduler.queue)
+
+		go next.callback()
+	}
+
+	return 0, false
+}
+
+func (scheduler *Scheduler) notify() {
+	select {
+	case scheduler.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+type timerQueue []*Timer
+
+func (queue timerQueue) Len() int {
+	return len(queue)
+}
+
+func (queue timerQueue) Less(i, j int) bool {
+	return queue[i].deadline.Before(queue[j].deadline)
+}
+
+func (queue timerQueue) Swap(i, j int) {
+	queue[i], queue[j] = queue[j], queue[i]
+	queue[i].index = i
+	queue[j].index = j
+}
+
+func (queue *timerQueue) Push(element interface{}) {
+	timer := element.(*Timer)
+	timer.index = len(*queue)
+
+	*queue = append(*queue, timer)
+}
+
+func (queue *timerQueue) Pop() interface{} {
+	old := *queue
+	last := len(old) - 1
+
+	timer := old[last]
+	timer.index = -1
+
+	old[last] = nil
+	*queue = old[:last]
+
+	return timer
+}
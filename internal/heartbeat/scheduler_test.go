@@ -0,0 +1,147 @@
+package heartbeat_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/byonchev/go-engine.io/internal/heartbeat"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchedulerAfterFunc(t *testing.T) {
+	scheduler := heartbeat.NewScheduler()
+	defer scheduler.Stop()
+
+	fired := make(chan time.Time, 1)
+	start := time.Now()
+
+	scheduler.AfterFunc(50*time.Millisecond, func() { fired <- time.Now() })
+
+	select {
+	case actual := <-fired:
+		assert.True(t, actual.Sub(start) >= 50*time.Millisecond, "timer fired before its deadline")
+	case <-time.After(time.Second):
+		t.Error("timer was not fired")
+	}
+}
+
+func TestSchedulerOrder(t *testing.T) {
+	scheduler := heartbeat.NewScheduler()
+	defer scheduler.Stop()
+
+	var lock sync.Mutex
+	var actual []int
+
+	var wait sync.WaitGroup
+
+	for _, i := range []int{3, 1, 2} {
+		i := i
+
+		wait.Add(1)
+
+		scheduler.AfterFunc(time.Duration(i)*30*time.Millisecond, func() {
+			lock.Lock()
+			actual = append(actual, i)
+			lock.Unlock()
+
+			wait.Done()
+		})
+	}
+
+	wait.Wait()
+
+	assert.Equal(t, []int{1, 2, 3}, actual, "timers were not fired in deadline order")
+}
+
+func TestTimerStop(t *testing.T) {
+	scheduler := heartbeat.NewScheduler()
+	defer scheduler.Stop()
+
+	fired := make(chan struct{}, 1)
+
+	timer := scheduler.AfterFunc(50*time.Millisecond, func() { fired <- struct{}{} })
+
+	assert.True(t, timer.Stop(), "scheduled timer was not stopped")
+	assert.False(t, timer.Stop(), "stopped timer was stopped twice")
+	assert.Equal(t, 0, scheduler.Len(), "stopped timer is still scheduled")
+
+	select {
+	case <-fired:
+		t.Error("stopped timer was fired")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestTimerReset(t *testing.T) {
+	scheduler := heartbeat.NewScheduler()
+	defer scheduler.Stop()
+
+	fired := make(chan time.Time, 1)
+	start := time.Now()
+
+	timer := scheduler.AfterFunc(30*time.Millisecond, func() { fired <- time.Now() })
+	timer.Reset(100 * time.Millisecond)
+
+	select {
+	case actual := <-fired:
+		assert.True(t, actual.Sub(start) >= 100*time.Millisecond, "timer fired before its postponed deadline")
+	case <-time.After(time.Second):
+		t.Error("reset timer was not fired")
+	}
+
+	timer.Reset(10 * time.Millisecond)
+
+	select {
+	case <-fired:
+	case <-time.After(time.Second):
+		t.Error("fired timer was not rescheduled")
+	}
+}
+
+func TestNewTimerNotScheduled(t *testing.T) {
+	scheduler := heartbeat.NewScheduler()
+	defer scheduler.Stop()
+
+	timer := scheduler.NewTimer(func() { t.Error("unscheduled timer was fired") })
+
+	assert.Equal(t, 0, scheduler.Len(), "new timer was scheduled")
+	assert.False(t, timer.Stop(), "unscheduled timer was stopped")
+
+	time.Sleep(50 * time.Millisecond)
+}
+
+func TestSchedulerStop(t *testing.T) {
+	scheduler := heartbeat.NewScheduler()
+
+	timer := scheduler.AfterFunc(30*time.Millisecond, func() { t.Error("timer was fired after scheduler stop") })
+
+	assert.False(t, scheduler.Stopped(), "new scheduler is stopped")
+
+	scheduler.Stop()
+	scheduler.Stop()
+
+	timer.Reset(10 * time.Millisecond)
+
+	assert.Equal(t, 0, scheduler.Len(), "timers are scheduled after scheduler stop")
+	assert.True(t, scheduler.Stopped(), "scheduler was not stopped")
+
+	time.Sleep(50 * time.Millisecond)
+}
+
+func BenchmarkTimerReset(b *testing.B) {
+	scheduler := heartbeat.NewScheduler()
+	defer scheduler.Stop()
+
+	timers := make([]*heartbeat.Timer, 100000)
+
+	for i := range timers {
+		timers[i] = scheduler.AfterFunc(time.Hour, func() {})
+	}
+
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		timers[n%len(timers)].Reset(time.Hour)
+	}
+}
@@ -1,6 +1,7 @@
 package packet
 
 import (
+	"context"
 	"sync"
 )
 
@@ -13,6 +14,11 @@ type Buffer struct {
 
 	payload Payload
 
+	// number of flushes waiting for packets
+	waiting int
+
+	drainWaiters []chan struct{}
+
 	closed bool
 }
 
@@ -49,17 +55,89 @@ func (buffer *Buffer) Close() {
 
 	buffer.closed = true
 
+	buffer.flushCondition.Broadcast()
+	buffer.notifyDrained()
+}
+
+// Reclaim removes and returns all buffered packets without waiting.
+// If a flush is waiting, the packets are left for it and nothing is returned
+func (buffer *Buffer) Reclaim() Payload {
+	buffer.Lock()
+	defer buffer.Unlock()
+
+	if buffer.waiting > 0 {
+		return nil
+	}
+
+	payload := buffer.payload
+
+	buffer.payload = nil
+	buffer.notifyDrained()
+
+	return payload
+}
+
+// Drained returns a channel which is closed once all buffered packets are flushed
+// or the buffer is closed
+func (buffer *Buffer) Drained() <-chan struct{} {
+	buffer.Lock()
+	defer buffer.Unlock()
+
+	drained := make(chan struct{})
+
+	if len(buffer.payload) == 0 || buffer.closed {
+		close(drained)
+	} else {
+		buffer.drainWaiters = append(buffer.drainWaiters, drained)
+	}
+
+	return drained
+}
+
+// Requeue puts packets which were flushed but not delivered
+// back in front of the buffered ones
+func (buffer *Buffer) Requeue(payload Payload) {
+	buffer.Lock()
+	defer buffer.Unlock()
+
+	if buffer.closed || len(payload) == 0 {
+		return
+	}
+
+	buffer.payload = append(payload[:len(payload):len(payload)], buffer.payload...)
+
 	buffer.flushCondition.Broadcast()
 }
 
 // Flush returns and clears the buffered payload.
 // If the buffer is empty, it blocks until at least one packet is present
 func (buffer *Buffer) Flush() Payload {
+	return buffer.FlushContext(context.Background())
+}
+
+// FlushContext is like Flush, but stops waiting for packets once the context is done.
+// No packets are flushed after the context is done
+func (buffer *Buffer) FlushContext(ctx context.Context) Payload {
+	stop := context.AfterFunc(ctx, func() {
+		buffer.Lock()
+		defer buffer.Unlock()
+
+		buffer.flushCondition.Broadcast()
+	})
+
+	defer stop()
+
 	buffer.Lock()
 	defer buffer.Unlock()
 
-	for len(buffer.payload) == 0 && !buffer.closed {
+	for len(buffer.payload) == 0 && !buffer.closed && ctx.Err() == nil {
+		buffer.waiting++
 		buffer.flushCondition.Wait()
+		buffer.waiting--
+	}
+
+	if ctx.Err() != nil {
+		return nil
 	}
 
 	length := len(buffer.payload)
@@ -73,5 +151,17 @@ func (buffer *Buffer) Flush() Payload {
 
 	buffer.payload = buffer.payload[limit:]
 
+	if len(buffer.payload) == 0 {
+		buffer.notifyDrained()
+	}
+
 	return payload
 }
+
+func (buffer *Buffer) notifyDrained() {
+	for _, drained := range buffer.drainWaiters {
+		close(drained)
+	}
+
+	buffer.drainWaiters = nil
+}
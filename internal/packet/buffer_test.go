@@ -1,6 +1,7 @@
 package packet_test
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -78,6 +79,55 @@ func TestBufferFlushWait(t *testing.T) {
 	assert.False(t, flushed, "buffer flush doesn't wait for at least one packet to be added")
 }
 
+func TestBufferFlushContext(t *testing.T) {
+	buffer := packet.NewBuffer(0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	result := make(chan packet.Payload)
+
+	go func() {
+		result <- buffer.FlushContext(ctx)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+
+	cancel()
+
+	select {
+	case payload := <-result:
+		assert.Nil(t, payload, "packets were flushed after cancellation")
+	case <-time.After(time.Second):
+		t.Error("flush was not released by cancellation")
+	}
+
+	buffer.Add(packet.NewNOOP())
+
+	assert.Nil(t, buffer.FlushContext(ctx), "packets were flushed with canceled context")
+	assert.Equal(t, packet.Payload{packet.NewNOOP()}, buffer.Flush(), "packets were lost by canceled flush")
+}
+
+func TestBufferRequeue(t *testing.T) {
+	buffer := packet.NewBuffer(0)
+
+	p1 := packet.NewPong(nil)
+	p2 := packet.NewStringMessage("hello")
+	p3 := packet.NewStringMessage("world")
+
+	buffer.Add(p1)
+	buffer.Add(p2)
+
+	flushed := buffer.Flush()
+
+	buffer.Add(p3)
+	buffer.Requeue(flushed)
+
+	expected := packet.Payload{p1, p2, p3}
+	actual := buffer.Flush()
+
+	assert.Equal(t, expected, actual, "requeued packets were not flushed first")
+}
+
 func TestBufferCloseSinglePacket(t *testing.T) {
 	buffer := packet.NewBuffer(0)
 
@@ -130,6 +180,92 @@ func TestBufferCloseLimit(t *testing.T) {
 	assert.Equal(t, expected, actual, "limited flush in closed buffer")
 }
 
+func TestBufferReclaim(t *testing.T) {
+	buffer := packet.NewBuffer(1)
+
+	p1 := packet.NewPong(nil)
+	p2 := packet.NewStringMessage("hello")
+
+	buffer.Add(p1)
+	buffer.Add(p2)
+
+	expected := packet.Payload{p1, p2}
+	actual := buffer.Reclaim()
+
+	assert.Equal(t, expected, actual, "reclaim doesn't return all buffered packets")
+	assert.Empty(t, buffer.Reclaim(), "reclaimed buffer is not empty")
+}
+
+func TestBufferReclaimWaiting(t *testing.T) {
+	buffer := packet.NewBuffer(0)
+
+	flushed := make(chan packet.Payload)
+
+	go func() {
+		flushed <- buffer.Flush()
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+
+	message := packet.NewStringMessage("hello")
+
+	buffer.Add(message)
+
+	assert.Empty(t, buffer.Reclaim(), "packets were taken from waiting flush")
+	assert.Equal(t, packet.Payload{message}, <-flushed, "waiting flush did not receive the packets")
+}
+
+func TestBufferDrained(t *testing.T) {
+	buffer := packet.NewBuffer(1)
+
+	buffer.Add(packet.NewStringMessage("hello"))
+	buffer.Add(packet.NewStringMessage("world"))
+
+	drained := buffer.Drained()
+
+	buffer.Flush()
+
+	select {
+	case <-drained:
+		t.Error("buffer was drained before all packets were flushed")
+	default:
+	}
+
+	buffer.Flush()
+
+	select {
+	case <-drained:
+	default:
+		t.Error("buffer was not drained after all packets were flushed")
+	}
+}
+
+func TestBufferDrainedEmpty(t *testing.T) {
+	buffer := packet.NewBuffer(0)
+
+	select {
+	case <-buffer.Drained():
+	default:
+		t.Error("empty buffer was not drained")
+	}
+}
+
+func TestBufferDrainedClose(t *testing.T) {
+	buffer := packet.NewBuffer(0)
+
+	buffer.Add(packet.NewNOOP())
+
+	drained := buffer.Drained()
+
+	buffer.Close()
+
+	select {
+	case <-drained:
+	default:
+		t.Error("closed buffer was not drained")
+	}
+}
+
 func BenchmarkBufferAdd(b *testing.B) {
 	buffer := packet.NewBuffer(10)
 
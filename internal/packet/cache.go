@@ -0,0 +1,47 @@
+package packet
+
+import "sync"
+
+// Format identifies the encoding of a single packet produced by a codec
+type Format int
+
+// Cache holds the encodings of a packet, so each format is encoded
+// once regardless of the number of sessions receiving the packet
+type Cache struct {
+	sync.Mutex
+
+	values map[interface{}]interface{}
+}
+
+// NewCache creates an empty encoding cache
+func NewCache() *Cache {
+	return &Cache{
+		values: make(map[interface{}]interface{}),
+	}
+}
+
+// Encoding returns the packet encoded in the format.
+// The encode function is called only for the first request of the format.
+// The returned slice is shared and must not be modified
+func (cache *Cache) Encoding(format Format, encode func() []byte) []byte {
+	return cache.Value(format, func() interface{} {
+		return encode()
+	}).([]byte)
+}
+
+// Value returns the value shared under the key, like messages prepared by a transport.
+// The create function is called only for the first request of the key.
+// Keys defined by different packages must have distinct types
+func (cache *Cache) Value(key interface{}, create func() interface{}) interface{} {
+	cache.Lock()
+	defer cache.Unlock()
+
+	value, found := cache.values[key]
+
+	if !found {
+		value = create()
+		cache.values[key] = value
+	}
+
+	return value
+}
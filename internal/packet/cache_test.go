@@ -0,0 +1,65 @@
+package packet_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/byonchev/go-engine.io/internal/packet"
+)
+
+func TestCacheEncoding(t *testing.T) {
+	cache := packet.NewCache()
+
+	calls := 0
+
+	encode := func() []byte {
+		calls++
+
+		return []byte{byte(calls)}
+	}
+
+	first := cache.Encoding(1, encode)
+	second := cache.Encoding(1, encode)
+	other := cache.Encoding(2, encode)
+
+	assert.Equal(t, []byte{1}, first, "wrong encoding")
+	assert.Equal(t, []byte{1}, second, "format was encoded twice")
+	assert.Equal(t, []byte{2}, other, "formats share encoding")
+}
+
+func TestCacheValue(t *testing.T) {
+	type key string
+
+	cache := packet.NewCache()
+
+	calls := 0
+
+	create := func() interface{} {
+		calls++
+
+		return calls
+	}
+
+	tests := []struct {
+		key      interface{}
+		expected interface{}
+	}{
+		{key("first"), 1},
+		{key("first"), 1},
+		{key("second"), 2},
+		{packet.Format(1), 3},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, cache.Value(test.key, create), "wrong value for key")
+	}
+}
+
+func TestNewBroadcast(t *testing.T) {
+	broadcast := packet.NewBroadcast(true, []byte{1})
+
+	assert.Equal(t, packet.NewBinaryMessage([]byte{1}).Data, broadcast.Data, "wrong broadcast data")
+	assert.True(t, broadcast.Binary, "wrong broadcast type")
+	assert.NotNil(t, broadcast.Cache, "broadcast has no cache")
+}
@@ -9,6 +9,9 @@ type Packet struct {
 	Binary bool
 	Type   Type
 	Data   []byte
+
+	// Cache shares the encodings of packets sent to multiple sessions
+	Cache *Cache
 }
 
 func (packet Packet) String() string {
@@ -17,27 +20,37 @@ func (packet Packet) String() string {
 
 // NewOpen creates new open packet
 func NewOpen(data []byte) Packet {
-	return Packet{false, Open, data}
+	return Packet{false, Open, data, nil}
 }
 
 // NewClose creates new close packet
 func NewClose() Packet {
-	return Packet{false, Close, []byte{}}
+	return Packet{false, Close, []byte{}, nil}
+}
+
+// NewPing creates new ping packet
+func NewPing(data []byte) Packet {
+	return Packet{false, Ping, data, nil}
 }
 
 // NewPong creates new pong packet
 func NewPong(data []byte) Packet {
-	return Packet{false, Pong, data}
+	return Packet{false, Pong, data, nil}
+}
+
+// NewUpgrade creates new upgrade packet
+func NewUpgrade() Packet {
+	return Packet{false, Upgrade, []byte{}, nil}
 }
 
 // NewStringMessage creates new string message packet
 func NewStringMessage(data string) Packet {
-	return Packet{false, Message, []byte(data)}
+	return Packet{false, Message, []byte(data), nil}
 }
 
 // NewBinaryMessage creates new binary message packet
 func NewBinaryMessage(data []byte) Packet {
-	return Packet{true, Message, data}
+	return Packet{true, Message, data, nil}
 }
 
 // NewMessage creates new message depending on its type
@@ -49,7 +62,15 @@ func NewMessage(binary bool, data []byte) Packet {
 	return NewStringMessage(string(data))
 }
 
+// NewBroadcast creates message with encodings shared by all recipients
+func NewBroadcast(binary bool, data []byte) Packet {
+	message := NewMessage(binary, data)
+	message.Cache = NewCache()
+
+	return message
+}
+
 // NewNOOP creates new NOOP packet
 func NewNOOP() Packet {
-	return Packet{false, NOOP, []byte{}}
+	return Packet{false, NOOP, []byte{}, nil}
 }
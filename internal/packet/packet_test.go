@@ -29,6 +29,14 @@ func TestPacketTypes(t *testing.T) {
 			},
 			packet.NewClose(),
 		},
+		{
+			packet.Packet{
+				Binary: false,
+				Type:   packet.Ping,
+				Data:   []byte("probe"),
+			},
+			packet.NewPing([]byte("probe")),
+		},
 		{
 			packet.Packet{
 				Binary: false,
@@ -77,6 +85,14 @@ func TestPacketTypes(t *testing.T) {
 			},
 			packet.NewNOOP(),
 		},
+		{
+			packet.Packet{
+				Binary: false,
+				Type:   packet.Upgrade,
+				Data:   []byte{},
+			},
+			packet.NewUpgrade(),
+		},
 	}
 
 	for _, test := range tests {
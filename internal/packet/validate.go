@@ -0,0 +1,44 @@
+package packet
+
+import (
+	"errors"
+	"unicode/utf8"
+)
+
+// Errors returned for packets violating the protocol
+var (
+	ErrUnknownType    = errors.New("unknown packet type")
+	ErrBinaryType     = errors.New("binary data in non-message packet")
+	ErrMissingData    = errors.New("missing packet data")
+	ErrUnexpectedData = errors.New("unexpected packet data")
+	ErrInvalidText    = errors.New("text packet is not valid UTF-8")
+)
+
+// Validate checks that the packet type is known
+// and the packet data is allowed for that type
+func (packet Packet) Validate() error {
+	if packet.Type > NOOP {
+		return ErrUnknownType
+	}
+
+	if packet.Binary && packet.Type != Message {
+		return ErrBinaryType
+	}
+
+	switch packet.Type {
+	case Open:
+		if len(packet.Data) == 0 {
+			return ErrMissingData
+		}
+	case Close, Upgrade, NOOP:
+		if len(packet.Data) > 0 {
+			return ErrUnexpectedData
+		}
+	}
+
+	if !packet.Binary && !utf8.Valid(packet.Data) {
+		return ErrInvalidText
+	}
+
+	return nil
+}
@@ -0,0 +1,37 @@
+package packet_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/byonchev/go-engine.io/internal/packet"
+)
+
+func TestPacketValidate(t *testing.T) {
+	tests := []struct {
+		packet packet.Packet
+		err    error
+	}{
+		{packet.NewOpen([]byte("{}")), nil},
+		{packet.NewClose(), nil},
+		{packet.NewPing([]byte("probe")), nil},
+		{packet.NewPong(nil), nil},
+		{packet.NewUpgrade(), nil},
+		{packet.NewNOOP(), nil},
+		{packet.NewStringMessage("hello ❤"), nil},
+		{packet.NewStringMessage(""), nil},
+		{packet.NewBinaryMessage([]byte{0xff}), nil},
+		{packet.Packet{Type: packet.TypeFromChar('9')}, packet.ErrUnknownType},
+		{packet.Packet{Binary: true, Type: packet.TypeFromByte(200)}, packet.ErrUnknownType},
+		{packet.Packet{Binary: true, Type: packet.Ping}, packet.ErrBinaryType},
+		{packet.NewOpen(nil), packet.ErrMissingData},
+		{packet.Packet{Type: packet.Close, Data: []byte("x")}, packet.ErrUnexpectedData},
+		{packet.Packet{Type: packet.NOOP, Data: []byte("x")}, packet.ErrUnexpectedData},
+		{packet.Packet{Type: packet.Message, Data: []byte{0xff}}, packet.ErrInvalidText},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.err, test.packet.Validate(), "wrong validation result for "+test.packet.String())
+	}
+}
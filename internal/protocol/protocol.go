@@ -0,0 +1,27 @@
+package protocol
+
+import (
+	"errors"
+)
+
+// Version is the engine.io protocol revision spoken by a client
+type Version int
+
+// Supported protocol revisions
+const (
+	V3 Version = 3
+	V4 Version = 4
+)
+
+// Parse returns the protocol revision from the value of the EIO query parameter.
+// Clients that omit the parameter are considered to speak revision 3
+func Parse(value string) (Version, error) {
+	switch value {
+	case "", "3":
+		return V3, nil
+	case "4":
+		return V4, nil
+	default:
+		return 0, errors.New("unsupported protocol version")
+	}
+}
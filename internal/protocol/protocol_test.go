@@ -0,0 +1,34 @@
+package protocol_test
+
+import (
+	"testing"
+
+	"github.com/byonchev/go-engine.io/internal/protocol"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected protocol.Version
+	}{
+		{"", protocol.V3},
+		{"3", protocol.V3},
+		{"4", protocol.V4},
+	}
+
+	for _, test := range tests {
+		actual, err := protocol.Parse(test.value)
+
+		assert.NoError(t, err, "error while parsing valid protocol version")
+		assert.Equal(t, test.expected, actual, "protocol version was not parsed properly")
+	}
+}
+
+func TestParseUnsupported(t *testing.T) {
+	for _, value := range []string{"1", "2", "5", "four"} {
+		_, err := protocol.Parse(value)
+
+		assert.Error(t, err, "error was expected for protocol version "+value)
+	}
+}
@@ -0,0 +1,158 @@
+package transport
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Content encodings supported for polling responses in order of preference
+var compressionEncodings = [...]string{"gzip", "deflate"}
+
+// Content-Encoding header values shared by all responses
+var encodingHeaders = map[string][]string{
+	"gzip":    {"gzip"},
+	"deflate": {"deflate"},
+}
+
+// compressor is a reusable writer compressing polling responses
+type compressor interface {
+	io.WriteCloser
+	Reset(io.Writer)
+}
+
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+var compressorPools = map[string]*sync.Pool{
+	"gzip": {
+		New: func() interface{} {
+			return gzip.NewWriter(nil)
+		},
+	},
+	"deflate": {
+		New: func() interface{} {
+			return zlib.NewWriter(nil)
+		},
+	},
+}
+
+// compress writes the data to the response with the selected content encoding
+func compress(writer http.ResponseWriter, encoding string, data []byte) error {
+	pool := compressorPools[encoding]
+
+	compressor := pool.Get().(compressor)
+	compressor.Reset(writer)
+
+	defer pool.Put(compressor)
+
+	writer.Header()["Content-Encoding"] = encodingHeaders[encoding]
+
+	_, err := compressor.Write(data)
+
+	if err != nil {
+		return err
+	}
+
+	return compressor.Close()
+}
+
+// varyEncoding marks the response as dependent on the Accept-Encoding header,
+// so shared caches do not serve compressed bodies to other clients
+func varyEncoding(header http.Header) {
+	for _, value := range header["Vary"] {
+		if strings.EqualFold(value, "Accept-Encoding") {
+			return
+		}
+	}
+
+	header.Add("Vary", "Accept-Encoding")
+}
+
+// acceptedEncoding selects the supported encoding with the highest quality
+// in the Accept-Encoding header or returns empty string if none is accepted
+func acceptedEncoding(header string) string {
+	if header == "" {
+		return ""
+	}
+
+	qualities := [len(compressionEncodings)]float64{-1, -1}
+	wildcard := -1.0
+
+	for header != "" {
+		var part, params string
+
+		part, header = cut(header, ',')
+		name, params := cut(part, ';')
+
+		name = strings.TrimSpace(name)
+		quality := 1.0
+
+		for params != "" {
+			var param string
+
+			param, params = cut(params, ';')
+			param = strings.TrimSpace(param)
+
+			if !strings.HasPrefix(param, "q=") {
+				continue
+			}
+
+			parsed, err := strconv.ParseFloat(param[2:], 64)
+
+			if err != nil {
+				parsed = 0
+			}
+
+			quality = parsed
+		}
+
+		if name == "*" {
+			wildcard = quality
+			continue
+		}
+
+		for i, encoding := range compressionEncodings {
+			if strings.EqualFold(name, encoding) {
+				qualities[i] = quality
+			}
+		}
+	}
+
+	selected := ""
+	best := 0.0
+
+	for i, encoding := range compressionEncodings {
+		quality := qualities[i]
+
+		if quality < 0 {
+			quality = wildcard
+		}
+
+		if quality > best {
+			selected = encoding
+			best = quality
+		}
+	}
+
+	return selected
+}
+
+// cut slices the string around the first separator
+func cut(value string, separator byte) (string, string) {
+	index := strings.IndexByte(value, separator)
+
+	if index < 0 {
+		return value, ""
+	}
+
+	return value[:index], value[index+1:]
+}
@@ -0,0 +1,134 @@
+package transport
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/byonchev/go-engine.io/internal/codec"
+	"github.com/byonchev/go-engine.io/internal/packet"
+)
+
+// framed transmits length-prefixed packets over a byte stream.
+// It is shared by the transports which are not bound to HTTP messages
+type framed struct {
+	maxBufferSize int64
+
+	writeLock sync.Mutex
+	readLock  sync.Mutex
+
+	stateLock sync.RWMutex
+	running   bool
+
+	writer io.Writer
+	reader *bufio.Reader
+	closer func()
+}
+
+// Shutdown closes the stream and interrupts pending receive.
+// Sent packets are written immediately, so none are returned
+func (transport *framed) Shutdown() packet.Payload {
+	transport.writeLock.Lock()
+	defer transport.writeLock.Unlock()
+
+	transport.close()
+
+	return nil
+}
+
+// Send writes packet to the stream
+func (transport *framed) Send(message packet.Packet) error {
+	transport.writeLock.Lock()
+	defer transport.writeLock.Unlock()
+
+	if !transport.Running() {
+		return errors.New("transport not running")
+	}
+
+	return transport.createCodec(false).Encode(packet.Payload{message}, transport.writer)
+}
+
+// Drain returns immediately, because packets are written to the stream on send
+func (transport *framed) Drain(ctx context.Context) error {
+	return nil
+}
+
+// Receive receives the next packet from the stream
+func (transport *framed) Receive() (packet.Packet, error) {
+	transport.readLock.Lock()
+	defer transport.readLock.Unlock()
+
+	if !transport.Running() {
+		return packet.Packet{}, io.EOF
+	}
+
+	payload, err := transport.createCodec(false).Decode(transport.reader)
+
+	if err == codec.ErrPacketTooLarge {
+		transport.close()
+
+		return packet.Packet{}, ErrPayloadTooLarge
+	}
+
+	if isDecodeError(err) {
+		return packet.Packet{}, err
+	}
+
+	if err != nil {
+		transport.close()
+
+		return packet.Packet{}, io.EOF
+	}
+
+	return payload[0], nil
+}
+
+// Running returns true if the transport is active
+func (transport *framed) Running() bool {
+	transport.stateLock.RLock()
+	defer transport.stateLock.RUnlock()
+
+	return transport.running
+}
+
+// attach sets the stream used for transmission.
+// The closer is called once the transport is stopped
+func (transport *framed) attach(stream io.ReadWriter, closer func()) {
+	transport.writer = stream
+	transport.reader = bufio.NewReader(stream)
+	transport.closer = closer
+}
+
+func (transport *framed) createCodec(handshake bool) codec.Codec {
+	return codec.Framed{
+		Handshake: handshake,
+		MaxLength: transport.maxBufferSize,
+	}
+}
+
+func (transport *framed) setRunning(running bool) {
+	transport.stateLock.Lock()
+	defer transport.stateLock.Unlock()
+
+	transport.running = running
+}
+
+func (transport *framed) close() {
+	transport.setRunning(false)
+
+	if transport.closer != nil {
+		transport.closer()
+	}
+}
+
+func (transport *framed) lock() {
+	transport.readLock.Lock()
+	transport.writeLock.Lock()
+}
+
+func (transport *framed) unlock() {
+	transport.readLock.Unlock()
+	transport.writeLock.Unlock()
+}
@@ -1,6 +1,8 @@
 package transport
 
 import (
+	"bytes"
+	"context"
 	"io"
 	"net/http"
 	"sync"
@@ -8,28 +10,49 @@ import (
 	"github.com/byonchev/go-engine.io/internal/codec"
 	"github.com/byonchev/go-engine.io/internal/logger"
 	"github.com/byonchev/go-engine.io/internal/packet"
+	"github.com/byonchev/go-engine.io/internal/protocol"
 )
 
 // Polling is the standard polling transport
 type Polling struct {
-	originCheck func(*http.Request) bool
+	protocol             protocol.Version
+	compression          bool
+	compressionThreshold int
+	maxBufferSize        int64
+	originCheck          func(*http.Request) bool
 
-	running bool
+	stateLock sync.RWMutex
+	running   bool
+	failure   error
+
+	shutdown sync.Once
+	done     chan struct{}
 
 	buffer *packet.Buffer
 
 	receiving sync.WaitGroup
 
+	// held by the pending GET and POST requests
+	pollRequest sync.Mutex
+	dataRequest sync.Mutex
+
 	received chan packet.Packet
+
+	flushHandler func()
 }
 
 // NewPolling creates new polling transport
-func NewPolling(bufferFlushLimit int, receiveBufferSize int, originCheck func(*http.Request) bool) *Polling {
+func NewPolling(protocol protocol.Version, bufferFlushLimit int, receiveBufferSize int, compression bool, compressionThreshold int, maxBufferSize int64, originCheck func(*http.Request) bool) *Polling {
 	transport := &Polling{
-		originCheck: originCheck,
-		buffer:      packet.NewBuffer(bufferFlushLimit),
-		received:    make(chan packet.Packet, receiveBufferSize),
-		running:     true,
+		protocol:             protocol,
+		compression:          compression,
+		compressionThreshold: compressionThreshold,
+		maxBufferSize:        maxBufferSize,
+		originCheck:          originCheck,
+		buffer:               packet.NewBuffer(bufferFlushLimit),
+		received:             make(chan packet.Packet, receiveBufferSize),
+		done:                 make(chan struct{}),
+		running:              true,
 	}
 
 	return transport
@@ -37,7 +60,7 @@ func NewPolling(bufferFlushLimit int, receiveBufferSize int, originCheck func(*h
 
 // HandleRequest handles HTTP polling requests
 func (transport *Polling) HandleRequest(writer http.ResponseWriter, request *http.Request) {
-	if !transport.running {
+	if !transport.Running() {
 		return
 	}
 
@@ -51,9 +74,9 @@ func (transport *Polling) HandleRequest(writer http.ResponseWriter, request *htt
 
 	switch method {
 	case "GET":
-		transport.write(writer, codec)
+		transport.write(request.Context(), writer, transport.responseEncoding(request), codec)
 	case "POST":
-		transport.read(request.Body, codec)
+		transport.receive(writer, request.Body, codec)
 	default:
 		writer.WriteHeader(http.StatusMethodNotAllowed)
 	}
@@ -68,72 +91,288 @@ func (transport *Polling) Send(packet packet.Packet) error {
 
 // Receive returns the last received packet or blocks until a packet is present
 func (transport *Polling) Receive() (packet.Packet, error) {
-	received, success := <-transport.received
+	select {
+	case received := <-transport.received:
+		return received, nil
+	case <-transport.done:
+	}
 
-	if !success {
-		return packet.Packet{}, io.EOF
+	select {
+	case received := <-transport.received:
+		return received, nil
+	default:
 	}
 
-	return received, nil
-}
+	transport.stateLock.RLock()
+	defer transport.stateLock.RUnlock()
 
-// Shutdown stops the transport from receiving or sending packets
-func (transport *Polling) Shutdown() {
-	if !transport.running {
-		return
+	if transport.failure != nil {
+		return packet.Packet{}, transport.failure
 	}
 
-	transport.running = false
-
-	transport.Send(packet.NewNOOP())
+	return packet.Packet{}, io.EOF
+}
 
-	transport.receiving.Wait()
-	transport.buffer.Close()
+// Drain blocks until all buffered packets are flushed by polling requests or the context is done
+func (transport *Polling) Drain(ctx context.Context) error {
+	select {
+	case <-transport.buffer.Drained():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
 
-	close(transport.received)
+// Shutdown stops the transport from receiving or sending packets.
+// Packets are delivered by the pending polling request if present,
+// otherwise the packets not yet flushed are returned
+func (transport *Polling) Shutdown() packet.Payload {
+	return transport.stop(true)
 }
 
 // Running returns true if the transport is active
 func (transport *Polling) Running() bool {
+	transport.stateLock.RLock()
+	defer transport.stateLock.RUnlock()
+
 	return transport.running
 }
 
+// OnFlush sets the handler called after buffered packets are written to the client.
+// It must be set before the first request is handled
+func (transport *Polling) OnFlush(handler func()) {
+	transport.flushHandler = handler
+}
+
 // Type returns the transport identifier
 func (transport *Polling) Type() string {
 	return PollingType
 }
 
-// Upgrades returns the possible transport upgrades
-func (transport *Polling) Upgrades() []string {
-	return []string{WebsocketType}
-}
+func (transport *Polling) read(reader io.Reader, codec codec.Codec) error {
+	if transport.maxBufferSize > 0 {
+		reader = &limitedReader{reader, transport.maxBufferSize}
+	}
 
-func (transport *Polling) read(reader io.Reader, codec codec.Codec) {
-	payload, err := codec.Decode(reader)
+	transport.receiving.Add(1)
+	defer transport.receiving.Done()
+
+	err := decodePayload(codec, reader, func(packet packet.Packet) {
+		select {
+		case transport.received <- packet:
+		case <-transport.done:
+		}
+	})
+
+	if err == ErrPayloadTooLarge {
+		logger.Error("Polling payload exceeds ", transport.maxBufferSize, " bytes")
+		return err
+	}
 
 	if err != nil {
 		logger.Error("Error decoding messages: ", err)
+		return err
+	}
+
+	return nil
+}
+
+// receive reads the packets sent by the client and fails the request
+// if the payload is too large, malformed or another one is pending
+func (transport *Polling) receive(writer http.ResponseWriter, reader io.Reader, codec codec.Codec) {
+	if !transport.dataRequest.TryLock() {
+		logger.Error("Overlapping polling data request")
+
+		transport.reject(writer)
 		return
 	}
 
-	transport.receiving.Add(1)
+	defer transport.dataRequest.Unlock()
 
-	for _, packet := range payload {
-		transport.received <- packet
+	err := transport.read(reader, codec)
+
+	switch {
+	case err == ErrPayloadTooLarge:
+		transport.fail(writer, http.StatusRequestEntityTooLarge, err)
+	case isDecodeError(err):
+		transport.fail(writer, http.StatusBadRequest, err)
 	}
+}
+
+// fail responds with the status code and shuts down the transport.
+// The error is returned on receive after all received packets
+func (transport *Polling) fail(writer http.ResponseWriter, status int, err error) {
+	writer.WriteHeader(status)
+
+	transport.setFailure(err)
+	transport.Shutdown()
+}
+
+// reject responds to an overlapping request and shuts down the transport
+// without waiting for the pending request to be read
+func (transport *Polling) reject(writer http.ResponseWriter) {
+	writer.WriteHeader(http.StatusBadRequest)
+
+	transport.setFailure(ErrPollOverlap)
+	transport.stop(false)
+}
+
+// stop shuts down the transport once. If wait is set, pending reads are finished
+// first, so the packets they receive are not lost
+func (transport *Polling) stop(wait bool) packet.Payload {
+	var pending packet.Payload
+
+	transport.shutdown.Do(func() {
+		transport.setRunning(false)
+
+		// a waiting poll still delivers the buffered packets
+		pending = transport.buffer.Reclaim()
+
+		transport.Send(packet.NewNOOP())
+
+		if wait {
+			transport.receiving.Wait()
+		}
 
-	transport.receiving.Done()
+		transport.buffer.Close()
+
+		close(transport.done)
+	})
+
+	return pending
 }
 
-func (transport *Polling) write(writer io.Writer, codec codec.Codec) {
-	payload := transport.buffer.Flush()
+func (transport *Polling) setRunning(running bool) {
+	transport.stateLock.Lock()
+	defer transport.stateLock.Unlock()
+
+	transport.running = running
+}
+
+// setFailure keeps the first error which failed the transport
+func (transport *Polling) setFailure(err error) {
+	transport.stateLock.Lock()
+	defer transport.stateLock.Unlock()
+
+	if transport.failure == nil {
+		transport.failure = err
+	}
+}
+
+// write flushes the buffered packets to the client. If the request is canceled
+// or the response cannot be written, the packets are kept for the next poll.
+// The request fails if another one is pending
+func (transport *Polling) write(ctx context.Context, writer http.ResponseWriter, encoding string, codec codec.Codec) {
+	if !transport.pollRequest.TryLock() {
+		logger.Error("Overlapping polling request")
+
+		transport.reject(writer)
+		return
+	}
+
+	defer transport.pollRequest.Unlock()
 
-	err := codec.Encode(payload, writer)
+	payload := transport.buffer.FlushContext(ctx)
+
+	if payload == nil {
+		return
+	}
+
+	err := ctx.Err()
+
+	if err == nil {
+		err = transport.encode(writer, encoding, codec, payload)
+	}
 
 	if err != nil {
-		logger.Error("Error encoding messages: ", err)
+		logger.Error("Error writing messages: ", err)
+
+		transport.buffer.Requeue(payload)
 		return
 	}
+
+	transport.flushed()
+}
+
+func (transport *Polling) encode(writer http.ResponseWriter, encoding string, codec codec.Codec, payload packet.Payload) error {
+	if transport.compression {
+		varyEncoding(writer.Header())
+	}
+
+	if encoding == "" {
+		return codec.Encode(payload, writer)
+	}
+
+	buffer := bufferPool.Get().(*bytes.Buffer)
+	buffer.Reset()
+
+	defer bufferPool.Put(buffer)
+
+	err := codec.Encode(payload, buffer)
+
+	if err != nil {
+		return err
+	}
+
+	if buffer.Len() < transport.compressionThreshold {
+		_, err = writer.Write(buffer.Bytes())
+
+		return err
+	}
+
+	return compress(writer, encoding, buffer.Bytes())
+}
+
+// responseEncoding returns the content encoding for polling responses
+// or empty string if the response should not be compressed
+func (transport *Polling) responseEncoding(request *http.Request) string {
+	if !transport.compression {
+		return ""
+	}
+
+	return acceptedEncoding(request.Header.Get("Accept-Encoding"))
+}
+
+// decodePayload passes the packets to the handler while they are decoded
+// if the codec supports streaming or after the whole payload is decoded
+func decodePayload(decoder codec.Codec, reader io.Reader, handler func(packet.Packet)) error {
+	if stream, ok := decoder.(codec.StreamCodec); ok {
+		return stream.DecodeStream(reader, handler)
+	}
+
+	payload, err := decoder.Decode(reader)
+
+	if err != nil {
+		return err
+	}
+
+	for _, packet := range payload {
+		handler(packet)
+	}
+
+	return nil
+}
+
+// limitedReader fails with ErrPayloadTooLarge if more than the allowed bytes are read
+type limitedReader struct {
+	reader    io.Reader
+	remaining int64
+}
+
+func (reader *limitedReader) Read(data []byte) (int, error) {
+	if int64(len(data)) > reader.remaining+1 {
+		data = data[:reader.remaining+1]
+	}
+
+	n, err := reader.reader.Read(data)
+
+	reader.remaining -= int64(n)
+
+	if reader.remaining < 0 {
+		return 0, ErrPayloadTooLarge
+	}
+
+	return n, err
 }
 
 func (transport *Polling) createCodec(request *http.Request) codec.Codec {
@@ -143,8 +382,14 @@ func (transport *Polling) createCodec(request *http.Request) codec.Codec {
 	j := query.Get("j")
 
 	if j != "" {
-		return codec.JSONP{Index: j}
+		return codec.JSONP{Index: j, Protocol: transport.protocol}
 	}
 
-	return codec.XHR{ForceBase64: b64 != ""}
+	return codec.XHR{ForceBase64: b64 != "", Protocol: transport.protocol}
+}
+
+func (transport *Polling) flushed() {
+	if transport.flushHandler != nil {
+		transport.flushHandler()
+	}
 }
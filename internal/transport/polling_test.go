@@ -2,13 +2,23 @@ package transport_test
 
 import (
 	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/byonchev/go-engine.io/internal/codec"
 	"github.com/byonchev/go-engine.io/internal/packet"
+	"github.com/byonchev/go-engine.io/internal/protocol"
 	"github.com/byonchev/go-engine.io/internal/transport"
 	"github.com/stretchr/testify/assert"
 )
@@ -62,9 +72,275 @@ func TestPollingSendAndShutdown(t *testing.T) {
 	assert.Equal(t, expected, actual, "packets were sent to the client after shutdown")
 }
 
+func TestPollingShutdownPending(t *testing.T) {
+	transport := createPollingTransport()
+
+	packets := packet.Payload{
+		packet.NewStringMessage("hello"),
+		packet.NewStringMessage("world"),
+	}
+
+	for _, packet := range packets {
+		transport.Send(packet)
+	}
+
+	expected := packets
+	actual := transport.Shutdown()
+
+	assert.Equal(t, expected, actual, "undelivered packets were not returned on shutdown")
+	assert.Empty(t, transport.Shutdown(), "packets were returned on second shutdown")
+}
+
+func TestPollingShutdownDeliversToPendingPoll(t *testing.T) {
+	codec := codec.XHR{}
+	transport := createPollingTransport()
+
+	pending := clientReceive(transport)
+
+	time.Sleep(50 * time.Millisecond)
+
+	sent := packet.NewStringMessage("hello")
+
+	transport.Send(sent)
+
+	assert.Empty(t, transport.Shutdown(), "packets were taken from pending poll")
+
+	actual, _ := codec.Decode(<-pending)
+
+	assert.Equal(t, sent, actual[0], "pending poll did not deliver the packets")
+}
+
+func TestPollingConcurrentShutdown(t *testing.T) {
+	transport := createPollingTransport()
+
+	var group sync.WaitGroup
+
+	for i := 0; i < 10; i++ {
+		group.Add(1)
+
+		go func() {
+			defer group.Done()
+
+			transport.Shutdown()
+		}()
+	}
+
+	group.Wait()
+
+	_, err := transport.Receive()
+
+	assert.Equal(t, io.EOF, err, "transport was not shut down")
+	assert.False(t, transport.Running(), "transport is still running")
+}
+
+func TestPollingDrain(t *testing.T) {
+	transport := createPollingTransport()
+
+	transport.Send(packet.NewNOOP())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	assert.Equal(t, context.DeadlineExceeded, transport.Drain(ctx), "transport was drained without polling request")
+
+	<-clientReceive(transport)
+
+	assert.NoError(t, transport.Drain(context.Background()), "transport was not drained after polling request")
+}
+
+func TestPollingCanceledRequest(t *testing.T) {
+	codec := codec.XHR{}
+	transport := createPollingTransport()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	request, _ := http.NewRequestWithContext(ctx, "GET", "/", nil)
+
+	done := make(chan struct{})
+
+	go func() {
+		transport.HandleRequest(httptest.NewRecorder(), request)
+		close(done)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("canceled poll was not released")
+	}
+
+	sent := packet.NewStringMessage("hello")
+
+	transport.Send(sent)
+
+	actual, _ := codec.Decode(<-clientReceive(transport))
+
+	assert.Equal(t, packet.Payload{sent}, actual, "packet was not delivered on the next poll")
+}
+
+func TestPollingRequeueOnWriteError(t *testing.T) {
+	codec := codec.XHR{}
+	transport := createPollingTransport()
+
+	sent := packet.NewStringMessage("hello")
+
+	transport.Send(sent)
+
+	request, _ := http.NewRequest("GET", "/", nil)
+
+	transport.HandleRequest(failingWriter{http.Header{}}, request)
+
+	actual, _ := codec.Decode(<-clientReceive(transport))
+
+	assert.Equal(t, packet.Payload{sent}, actual, "undelivered packet was not sent on the next poll")
+}
+
+func TestPollingOverlappingPoll(t *testing.T) {
+	codec := codec.XHR{}
+	pending := createPollingTransport()
+
+	first := clientReceive(pending)
+
+	time.Sleep(50 * time.Millisecond)
+
+	request, _ := http.NewRequest("GET", "/", nil)
+	writer := httptest.NewRecorder()
+
+	pending.HandleRequest(writer, request)
+
+	actual, _ := codec.Decode(<-first)
+	_, err := pending.Receive()
+
+	assert.Equal(t, http.StatusBadRequest, writer.Code, "overlapping poll was accepted")
+	assert.Equal(t, packet.Payload{packet.NewNOOP()}, actual, "pending poll was not released")
+	assert.Equal(t, transport.ErrPollOverlap, err, "overlap error was not returned")
+	assert.False(t, pending.Running(), "transport was not shut down")
+}
+
+func TestPollingOverlappingDataRequest(t *testing.T) {
+	pending := transport.NewPolling(protocol.V3, 0, 10, false, 0, 0, nil)
+
+	reader, writer := io.Pipe()
+	defer writer.Close()
+
+	request, _ := http.NewRequest("POST", "/", reader)
+
+	go pending.HandleRequest(httptest.NewRecorder(), request)
+
+	writer.Write([]byte("6:4hello"))
+
+	message, _ := pending.Receive()
+
+	overlapping, _ := http.NewRequest("POST", "/", bytes.NewBufferString("6:4world"))
+	recorder := httptest.NewRecorder()
+
+	rejected := make(chan struct{})
+
+	go func() {
+		pending.HandleRequest(recorder, overlapping)
+		close(rejected)
+	}()
+
+	select {
+	case <-rejected:
+	case <-time.After(time.Second):
+		assert.Fail(t, "overlapping data request waited for the pending one")
+		return
+	}
+
+	_, err := pending.Receive()
+
+	assert.Equal(t, http.StatusBadRequest, recorder.Code, "overlapping data request was accepted")
+	assert.Equal(t, packet.NewStringMessage("hello"), message, "packet from pending request was not received")
+	assert.Equal(t, transport.ErrPollOverlap, err, "overlap error was not returned")
+	assert.False(t, pending.Running(), "transport was not shut down")
+}
+
+func TestPollingFlushHandler(t *testing.T) {
+	tests := []struct {
+		name    string
+		request func(*transport.Polling)
+		flushes int32
+	}{
+		{
+			"delivered",
+			func(polling *transport.Polling) {
+				polling.Send(packet.NewStringMessage("hello"))
+
+				<-clientReceive(polling)
+			},
+			1,
+		},
+		{
+			"write error",
+			func(polling *transport.Polling) {
+				polling.Send(packet.NewStringMessage("hello"))
+
+				request, _ := http.NewRequest("GET", "/", nil)
+
+				polling.HandleRequest(failingWriter{http.Header{}}, request)
+			},
+			0,
+		},
+		{
+			"canceled",
+			func(polling *transport.Polling) {
+				ctx, cancel := context.WithCancel(context.Background())
+
+				request, _ := http.NewRequestWithContext(ctx, "GET", "/", nil)
+
+				time.AfterFunc(50*time.Millisecond, cancel)
+
+				polling.HandleRequest(httptest.NewRecorder(), request)
+			},
+			0,
+		},
+		{
+			"overlapping",
+			func(polling *transport.Polling) {
+				first := clientReceive(polling)
+
+				time.Sleep(50 * time.Millisecond)
+
+				request, _ := http.NewRequest("GET", "/", nil)
+
+				polling.HandleRequest(httptest.NewRecorder(), request)
+
+				<-first
+			},
+			1,
+		},
+		{
+			"shut down",
+			func(polling *transport.Polling) {
+				polling.Shutdown()
+				polling.Send(packet.NewStringMessage("hello"))
+
+				<-clientReceive(polling)
+			},
+			0,
+		},
+	}
+
+	for _, test := range tests {
+		var flushes int32
+
+		polling := createPollingTransport()
+		polling.OnFlush(func() { atomic.AddInt32(&flushes, 1) })
+
+		test.request(polling)
+
+		assert.Equal(t, test.flushes, atomic.LoadInt32(&flushes), test.name)
+	}
+}
+
 func TestPollingReceivePayload(t *testing.T) {
 	codec := codec.XHR{}
-	transport := transport.NewPolling(0, 10, nil)
+	transport := transport.NewPolling(protocol.V3, 0, 10, false, 0, 0, nil)
 
 	payload := packet.Payload{
 		packet.NewStringMessage("hello"),
@@ -85,9 +361,37 @@ func TestPollingReceivePayload(t *testing.T) {
 	}
 }
 
+func TestPollingReceiveStream(t *testing.T) {
+	transport := transport.NewPolling(protocol.V3, 0, 10, false, 0, 0, nil)
+
+	reader, writer := io.Pipe()
+
+	request, _ := http.NewRequest("POST", "/", reader)
+
+	go transport.HandleRequest(httptest.NewRecorder(), request)
+
+	writer.Write([]byte("6:4hello"))
+
+	received := make(chan packet.Packet)
+
+	go func() {
+		message, _ := transport.Receive()
+		received <- message
+	}()
+
+	select {
+	case message := <-received:
+		assert.Equal(t, packet.NewStringMessage("hello"), message, "wrong packet was received")
+	case <-time.After(time.Second):
+		assert.Fail(t, "packet was not received before the payload end")
+	}
+
+	writer.Close()
+}
+
 func TestPollingReceiveAndShutdown(t *testing.T) {
 	codec := codec.XHR{}
-	transport := transport.NewPolling(0, 10, nil)
+	transport := transport.NewPolling(protocol.V3, 0, 10, false, 0, 0, nil)
 
 	sent := packet.NewNOOP()
 
@@ -105,6 +409,21 @@ func TestPollingReceiveAndShutdown(t *testing.T) {
 	assert.Equal(t, expected, actual, "payload was not received due to transport shutdown")
 }
 
+func TestPollingPayloadTooLarge(t *testing.T) {
+	limited := transport.NewPolling(protocol.V3, 0, 10, false, 0, 5, nil)
+
+	request, _ := http.NewRequest("POST", "/", bytes.NewBufferString("6:4hello"))
+	writer := httptest.NewRecorder()
+
+	limited.HandleRequest(writer, request)
+
+	_, err := limited.Receive()
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, writer.Code, "oversized payload was accepted")
+	assert.Equal(t, transport.ErrPayloadTooLarge, err, "oversized payload error was not returned")
+	assert.False(t, limited.Running(), "transport was not shut down")
+}
+
 func TestPollingInvalidHTTPMethod(t *testing.T) {
 	transport := createPollingTransport()
 
@@ -119,20 +438,115 @@ func TestPollingInvalidHTTPMethod(t *testing.T) {
 func TestPollingReceiveInvalidPayload(t *testing.T) {
 	transport := createPollingTransport()
 
-	buffer := bytes.NewBuffer([]byte("INVALID:INVALID"))
+	request, _ := http.NewRequest("POST", "/", bytes.NewBufferString("INVALID:INVALID"))
+	writer := httptest.NewRecorder()
 
-	clientSend(transport, buffer)
+	transport.HandleRequest(writer, request)
 
-	go func() {
-		transport.Receive()
-		t.Error("invalid received packet was processed")
-	}()
+	_, err := transport.Receive()
 
-	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, http.StatusBadRequest, writer.Code, "invalid payload was accepted")
+	assert.IsType(t, &codec.DecodeError{}, err, "decode error was not returned")
+	assert.False(t, transport.Running(), "transport was not shut down")
+}
+
+func TestPollingCompression(t *testing.T) {
+	message := packet.NewStringMessage(strings.Repeat("hello", 10))
+
+	tests := []struct {
+		acceptEncoding string
+		threshold      int
+		encoding       string
+	}{
+		{"gzip, deflate", 10, "gzip"},
+		{"deflate", 10, "deflate"},
+		{"gzip;q=0.5, deflate", 10, "deflate"},
+		{"gzip;q=0, *", 10, "deflate"},
+		{"*", 10, "gzip"},
+		{"br", 10, ""},
+		{"", 10, ""},
+		{"gzip", 100, ""},
+	}
+
+	for _, test := range tests {
+		polling := transport.NewPolling(protocol.V4, 0, 0, true, test.threshold, 0, nil)
+		polling.Send(message)
+
+		request, _ := http.NewRequest("GET", "/", nil)
+		request.Header.Set("Accept-Encoding", test.acceptEncoding)
+
+		writer := httptest.NewRecorder()
+
+		polling.HandleRequest(writer, request)
+
+		encoding := writer.Header().Get("Content-Encoding")
+
+		assert.Equal(t, test.encoding, encoding, "wrong encoding for "+test.acceptEncoding)
+		assert.Equal(t, []string{"Accept-Encoding"}, writer.Header()["Vary"], "response does not vary by encoding")
+
+		var body io.Reader = writer.Body
+
+		switch encoding {
+		case "gzip":
+			body, _ = gzip.NewReader(body)
+		case "deflate":
+			body, _ = zlib.NewReader(body)
+		}
+
+		decoded, _ := ioutil.ReadAll(body)
+
+		assert.Equal(t, "4"+string(message.Data), string(decoded), "response was not compressed properly")
+	}
 }
 
+func BenchmarkPollingCompression(b *testing.B) {
+	polling := transport.NewPolling(protocol.V4, 0, 0, true, 0, 0, nil)
+
+	request, _ := http.NewRequest("GET", "/", nil)
+	request.Header.Set("Accept-Encoding", "gzip")
+
+	message := packet.NewStringMessage(strings.Repeat("hello", 100))
+	writer := discardWriter{http.Header{}}
+
+	b.ReportAllocs()
+
+	for n := 0; n < b.N; n++ {
+		polling.Send(message)
+		polling.HandleRequest(writer, request)
+	}
+}
+
+type discardWriter struct {
+	header http.Header
+}
+
+func (writer discardWriter) Header() http.Header {
+	return writer.header
+}
+
+func (writer discardWriter) Write(data []byte) (int, error) {
+	return len(data), nil
+}
+
+func (writer discardWriter) WriteHeader(int) {}
+
+// failingWriter fails like a response to a disconnected client
+type failingWriter struct {
+	header http.Header
+}
+
+func (writer failingWriter) Header() http.Header {
+	return writer.header
+}
+
+func (writer failingWriter) Write(data []byte) (int, error) {
+	return 0, errors.New("connection closed")
+}
+
+func (writer failingWriter) WriteHeader(int) {}
+
 func createPollingTransport() *transport.Polling {
-	return transport.NewPolling(0, 0, nil)
+	return transport.NewPolling(protocol.V3, 0, 0, false, 0, 0, nil)
 }
 
 func clientReceive(transport transport.Transport) <-chan *bytes.Buffer {
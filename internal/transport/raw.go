@@ -0,0 +1,39 @@
+package transport
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/byonchev/go-engine.io/internal/logger"
+)
+
+// Raw transmits length-prefixed packets over a TCP or Unix socket connection
+// accepted outside of HTTP. The session is opened by the connection itself
+type Raw struct {
+	framed
+}
+
+// NewRaw creates new transport for the accepted connection
+func NewRaw(conn net.Conn, maxBufferSize int64) *Raw {
+	transport := &Raw{
+		framed: framed{maxBufferSize: maxBufferSize, running: true},
+	}
+
+	transport.attach(conn, func() {
+		conn.Close()
+	})
+
+	return transport
+}
+
+// HandleRequest rejects HTTP requests, because raw connections are not served over HTTP
+func (transport *Raw) HandleRequest(writer http.ResponseWriter, request *http.Request) {
+	logger.Error("Raw transport does not serve HTTP requests")
+
+	writer.WriteHeader(http.StatusBadRequest)
+}
+
+// Type returns the transport identifier
+func (transport *Raw) Type() string {
+	return RawType
+}
@@ -0,0 +1,126 @@
+package transport_test
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/byonchev/go-engine.io/internal/codec"
+	"github.com/byonchev/go-engine.io/internal/packet"
+	"github.com/byonchev/go-engine.io/internal/transport"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRawSend(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	raw := transport.NewRaw(server, 0)
+	reader := bufio.NewReader(client)
+
+	tests := []packet.Packet{
+		packet.NewStringMessage("hello"),
+		packet.NewBinaryMessage([]byte{1, 2, 3}),
+	}
+
+	for _, test := range tests {
+		go raw.Send(test)
+
+		payload, err := codec.Framed{}.Decode(reader)
+
+		assert.Nil(t, err, "error while reading packet")
+		assert.Equal(t, packet.Payload{test}, payload, "packet was not received by client")
+	}
+}
+
+func TestRawReceive(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	raw := transport.NewRaw(server, 0)
+
+	tests := []packet.Packet{
+		packet.NewStringMessage("hello"),
+		packet.NewBinaryMessage([]byte{1, 2, 3}),
+	}
+
+	for _, test := range tests {
+		go codec.Framed{}.Encode(packet.Payload{test}, client)
+
+		received, err := raw.Receive()
+
+		assert.Nil(t, err, "error while receiving packet")
+		assert.Equal(t, test, received, "packet was not received from client")
+	}
+}
+
+func TestRawPayloadTooLarge(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	raw := transport.NewRaw(server, 5)
+
+	go codec.Framed{}.Encode(packet.Payload{packet.NewStringMessage("hello world")}, client)
+
+	_, err := raw.Receive()
+
+	assert.Equal(t, transport.ErrPayloadTooLarge, err, "oversized payload error was not returned")
+	assert.False(t, raw.Running(), "transport was not shut down")
+}
+
+func TestRawClientClose(t *testing.T) {
+	server, client := net.Pipe()
+
+	raw := transport.NewRaw(server, 0)
+
+	client.Close()
+
+	_, err := raw.Receive()
+
+	assert.Error(t, err, "error was not returned after the client closed the connection")
+	assert.False(t, raw.Running(), "transport was not shut down")
+}
+
+func TestRawShutdownDuringReceive(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	raw := transport.NewRaw(server, 0)
+
+	result := make(chan error)
+
+	go func() {
+		_, err := raw.Receive()
+		result <- err
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+
+	raw.Shutdown()
+
+	select {
+	case err := <-result:
+		assert.Error(t, err, "error was not returned from receive interrupted by shutdown")
+	case <-time.After(time.Second):
+		t.Error("shutdown did not interrupt pending receive")
+	}
+
+	assert.Error(t, raw.Send(packet.NewNOOP()), "packet was sent after shutdown")
+}
+
+func TestRawHTTPRequest(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	raw := transport.NewRaw(server, 0)
+
+	request, _ := http.NewRequest("GET", "/", nil)
+	writer := httptest.NewRecorder()
+
+	raw.HandleRequest(writer, request)
+
+	assert.Equal(t, http.StatusBadRequest, writer.Code, "http request was accepted")
+}
@@ -0,0 +1,104 @@
+package transport
+
+import (
+	"sync"
+
+	"github.com/byonchev/go-engine.io/internal/config"
+	"github.com/byonchev/go-engine.io/internal/protocol"
+)
+
+// Factory creates the transport of a session for the client protocol
+type Factory func(protocol.Version, config.Config) Transport
+
+type registration struct {
+	name         string
+	factory      Factory
+	upgradesFrom []string
+}
+
+// Registry holds the transports available to the sessions of a server in registration order
+type Registry struct {
+	sync.RWMutex
+
+	transports []registration
+}
+
+// NewRegistry creates registry with the built-in transports
+func NewRegistry() *Registry {
+	registry := &Registry{}
+
+	registry.Register(PollingType, CreatePolling)
+	registry.Register(WebsocketType, CreateWebsocket, PollingType)
+	registry.Register(SSEType, CreateSSE)
+
+	return registry
+}
+
+// Register makes the transport available by name.
+// Clients of the transports in upgradesFrom can upgrade to the registered one.
+// Registering an existing name replaces the previous transport
+func (registry *Registry) Register(name string, factory Factory, upgradesFrom ...string) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	entry := registration{name, factory, upgradesFrom}
+
+	for i, existing := range registry.transports {
+		if existing.name == name {
+			registry.transports[i] = entry
+			return
+		}
+	}
+
+	registry.transports = append(registry.transports, entry)
+}
+
+// Registered returns true if a transport is registered with the name
+func (registry *Registry) Registered(name string) bool {
+	_, found := registry.lookup(name)
+
+	return found
+}
+
+// NewTransport creates a registered transport for the client protocol
+// or returns nil if the transport is not registered
+func (registry *Registry) NewTransport(name string, protocol protocol.Version, config config.Config) Transport {
+	entry, found := registry.lookup(name)
+
+	if !found {
+		return nil
+	}
+
+	return entry.factory(protocol, config)
+}
+
+// Upgrades returns the registered transports to which clients of the transport can upgrade
+func (registry *Registry) Upgrades(name string) []string {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	result := []string{}
+
+	for _, entry := range registry.transports {
+		for _, source := range entry.upgradesFrom {
+			if source == name {
+				result = append(result, entry.name)
+			}
+		}
+	}
+
+	return result
+}
+
+func (registry *Registry) lookup(name string) (registration, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	for _, entry := range registry.transports {
+		if entry.name == name {
+			return entry, true
+		}
+	}
+
+	return registration{}, false
+}
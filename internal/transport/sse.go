@@ -0,0 +1,106 @@
+package transport
+
+import (
+	"net/http"
+
+	"github.com/byonchev/go-engine.io/internal/codec"
+	"github.com/byonchev/go-engine.io/internal/logger"
+	"github.com/byonchev/go-engine.io/internal/protocol"
+)
+
+// SSE pushes packets to the client as server-sent events on a long-lived GET request.
+// Packets sent by the client are received from POST requests like polling.
+// Overlapping event streams fail the transport like overlapping polls
+type SSE struct {
+	*Polling
+}
+
+// NewSSE creates new server-sent events transport
+func NewSSE(protocol protocol.Version, bufferFlushLimit int, receiveBufferSize int, maxBufferSize int64, originCheck func(*http.Request) bool) *SSE {
+	polling := NewPolling(protocol, bufferFlushLimit, receiveBufferSize, false, 0, maxBufferSize, originCheck)
+
+	return &SSE{Polling: polling}
+}
+
+// HandleRequest streams the buffered packets on GET requests
+// and reads the packets sent by the client on POST requests
+func (transport *SSE) HandleRequest(writer http.ResponseWriter, request *http.Request) {
+	if !transport.Running() {
+		return
+	}
+
+	if transport.originCheck != nil && !transport.originCheck(request) {
+		writer.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	codec := codec.SSE{Protocol: transport.protocol}
+
+	switch request.Method {
+	case "GET":
+		transport.stream(writer, request, codec)
+	case "POST":
+		transport.receive(writer, request.Body, codec)
+	default:
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// Type returns the transport identifier
+func (transport *SSE) Type() string {
+	return SSEType
+}
+
+// stream writes the buffered packets as events until the client disconnects
+// or the transport is shut down
+func (transport *SSE) stream(writer http.ResponseWriter, request *http.Request, codec codec.Codec) {
+	flusher, ok := writer.(http.Flusher)
+
+	if !ok {
+		logger.Error("Event stream is not supported by the response writer")
+
+		writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if !transport.pollRequest.TryLock() {
+		logger.Error("Event stream is already open")
+
+		transport.reject(writer)
+		return
+	}
+
+	defer transport.pollRequest.Unlock()
+
+	header := writer.Header()
+
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("X-Accel-Buffering", "no")
+
+	writer.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ctx := request.Context()
+
+	for transport.Running() {
+		payload := transport.buffer.FlushContext(ctx)
+
+		if payload == nil {
+			return
+		}
+
+		err := codec.Encode(payload, writer)
+
+		if err != nil {
+			logger.Error("Error writing messages: ", err)
+
+			transport.buffer.Requeue(payload)
+			return
+		}
+
+		flusher.Flush()
+
+		transport.flushed()
+	}
+}
@@ -0,0 +1,178 @@
+package transport_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/byonchev/go-engine.io/internal/codec"
+	"github.com/byonchev/go-engine.io/internal/packet"
+	"github.com/byonchev/go-engine.io/internal/protocol"
+	"github.com/byonchev/go-engine.io/internal/transport"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSSEStream(t *testing.T) {
+	sse := createSSETransport()
+
+	server := httptest.NewServer(http.HandlerFunc(sse.HandleRequest))
+	defer server.Close()
+
+	response, err := http.Get(server.URL)
+
+	assert.Nil(t, err, "event stream was not opened")
+	assert.Equal(t, "text/event-stream", response.Header.Get("Content-Type"), "wrong content type")
+
+	defer response.Body.Close()
+
+	reader := bufio.NewReader(response.Body)
+
+	tests := []struct {
+		packet packet.Packet
+		event  string
+	}{
+		{packet.NewStringMessage("hello\nworld"), `data: "4hello\nworld"`},
+		{packet.NewBinaryMessage([]byte{2, 4, 8}), `data: "bAgQI"`},
+	}
+
+	for _, test := range tests {
+		sse.Send(test.packet)
+
+		assert.Equal(t, test.event, readEvent(reader), "packet was not streamed to client")
+	}
+
+	sse.Shutdown()
+}
+
+func TestSSEReceive(t *testing.T) {
+	sse := createSSETransport()
+
+	payload := packet.Payload{
+		packet.NewStringMessage("hello"),
+		packet.NewBinaryMessage([]byte{2, 4, 8}),
+	}
+
+	var buffer bytes.Buffer
+
+	codec.XHR{Protocol: protocol.V4}.Encode(payload, &buffer)
+
+	clientSend(sse, &buffer)
+
+	for _, expected := range payload {
+		actual, err := sse.Receive()
+
+		assert.NoError(t, err, "error while receiving sent packets")
+		assert.Equal(t, expected, actual, "packets sent from client were not received")
+	}
+}
+
+func TestSSESingleStream(t *testing.T) {
+	sse := createSSETransport()
+
+	server := httptest.NewServer(http.HandlerFunc(sse.HandleRequest))
+	defer server.Close()
+
+	first, err := http.Get(server.URL)
+
+	assert.Nil(t, err, "event stream was not opened")
+
+	second, err := http.Get(server.URL)
+
+	assert.Nil(t, err, "second request failed")
+	assert.Equal(t, http.StatusBadRequest, second.StatusCode, "second event stream was opened")
+
+	second.Body.Close()
+	first.Body.Close()
+
+	_, err = sse.Receive()
+
+	assert.Equal(t, transport.ErrPollOverlap, err, "overlap error was not returned")
+	assert.False(t, sse.Running(), "transport was not shut down")
+}
+
+func TestSSEReconnect(t *testing.T) {
+	sse := createSSETransport()
+
+	server := httptest.NewServer(http.HandlerFunc(sse.HandleRequest))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	request, _ := http.NewRequestWithContext(ctx, "GET", server.URL, nil)
+
+	_, err := http.DefaultClient.Do(request)
+
+	assert.Nil(t, err, "event stream was not opened")
+
+	cancel()
+
+	time.Sleep(50 * time.Millisecond)
+
+	response, err := http.Get(server.URL)
+
+	assert.Nil(t, err, "event stream was not reopened")
+	assert.Equal(t, http.StatusOK, response.StatusCode, "event stream was not released on disconnect")
+
+	defer response.Body.Close()
+
+	sse.Send(packet.NewStringMessage("hello"))
+
+	reader := bufio.NewReader(response.Body)
+
+	assert.Equal(t, `data: "4hello"`, readEvent(reader), "packet was not streamed after reconnect")
+
+	sse.Shutdown()
+}
+
+func TestSSEFlushHandler(t *testing.T) {
+	sse := createSSETransport()
+
+	flushed := make(chan struct{}, 1)
+
+	sse.OnFlush(func() { flushed <- struct{}{} })
+
+	server := httptest.NewServer(http.HandlerFunc(sse.HandleRequest))
+	defer server.Close()
+
+	response, err := http.Get(server.URL)
+
+	assert.Nil(t, err, "event stream was not opened")
+
+	defer response.Body.Close()
+
+	reader := bufio.NewReader(response.Body)
+
+	for _, message := range []string{"hello", "world"} {
+		sse.Send(packet.NewStringMessage(message))
+
+		readEvent(reader)
+
+		select {
+		case <-flushed:
+		case <-time.After(time.Second):
+			assert.Fail(t, "flush handler was not called for streamed event")
+		}
+	}
+
+	sse.Shutdown()
+}
+
+func createSSETransport() *transport.SSE {
+	return transport.NewSSE(protocol.V4, 0, 10, 0, nil)
+}
+
+// readEvent returns the data line of the next event
+func readEvent(reader *bufio.Reader) string {
+	line, _ := reader.ReadString('\n')
+	reader.ReadString('\n')
+
+	if len(line) == 0 {
+		return ""
+	}
+
+	return line[:len(line)-1]
+}
@@ -0,0 +1,99 @@
+package transport
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/byonchev/go-engine.io/internal/logger"
+)
+
+// streamOpenTimeout limits the wait for the client to send the open packet
+const streamOpenTimeout = 10 * time.Second
+
+// StreamUpgrader upgrades the request to a byte stream opened by the client.
+// The closer is called once the transport is stopped.
+// On error the upgrader has already responded to the request
+type StreamUpgrader func(http.ResponseWriter, *http.Request) (io.ReadWriter, func(), error)
+
+// Stream transmits length-prefixed packets over a byte stream obtained
+// by upgrading the HTTP request, like the stream of a WebTransport session
+type Stream struct {
+	framed
+
+	streamType  string
+	upgrader    StreamUpgrader
+	originCheck func(*http.Request) bool
+}
+
+// NewStream creates new transport upgrading the requests with the upgrader.
+// Sending and receiving wait until the request is handled
+func NewStream(streamType string, upgrader StreamUpgrader, maxBufferSize int64, originCheck func(*http.Request) bool) *Stream {
+	transport := &Stream{
+		framed: framed{maxBufferSize: maxBufferSize, running: false},
+
+		streamType:  streamType,
+		upgrader:    upgrader,
+		originCheck: originCheck,
+	}
+
+	transport.lock()
+
+	return transport
+}
+
+// HandleRequest upgrades the request and waits for the client
+// to open the stream with an open packet
+func (transport *Stream) HandleRequest(writer http.ResponseWriter, request *http.Request) {
+	defer transport.unlock()
+
+	if transport.originCheck != nil && !transport.originCheck(request) {
+		logger.Error("Stream origin not allowed: ", request.Header.Get("Origin"))
+
+		writer.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	stream, closer, err := transport.upgrader(writer, request)
+
+	if err != nil {
+		logger.Error("Stream upgrade failed: ", err)
+		return
+	}
+
+	transport.attach(stream, closer)
+
+	err = transport.open(stream)
+
+	if err != nil {
+		logger.Error("Stream was not opened: ", err)
+
+		transport.close()
+		return
+	}
+
+	transport.setRunning(true)
+}
+
+// Type returns the transport identifier
+func (transport *Stream) Type() string {
+	return transport.streamType
+}
+
+// open reads the open packet sent by the client.
+// Clients upgrading from another transport identify the session in the request query
+func (transport *Stream) open(stream io.ReadWriter) error {
+	deadline, ok := stream.(interface{ SetReadDeadline(time.Time) error })
+
+	if ok {
+		deadline.SetReadDeadline(time.Now().Add(streamOpenTimeout))
+	}
+
+	_, err := transport.createCodec(true).Decode(transport.reader)
+
+	if err != nil || !ok {
+		return err
+	}
+
+	return deadline.SetReadDeadline(time.Time{})
+}
@@ -0,0 +1,146 @@
+package transport_test
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/byonchev/go-engine.io/internal/codec"
+	"github.com/byonchev/go-engine.io/internal/packet"
+	"github.com/byonchev/go-engine.io/internal/transport"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreamSend(t *testing.T) {
+	stream, client := setupStream(t, 0)
+	defer client.Close()
+
+	reader := bufio.NewReader(client)
+
+	tests := []packet.Packet{
+		packet.NewStringMessage("Hello ❤"),
+		packet.NewBinaryMessage([]byte{1, 2, 3}),
+	}
+
+	for _, test := range tests {
+		go stream.Send(test)
+
+		payload, err := codec.Framed{}.Decode(reader)
+
+		assert.Nil(t, err, "error while reading packet")
+		assert.Equal(t, packet.Payload{test}, payload, "packet was not received by client")
+	}
+}
+
+func TestStreamReceive(t *testing.T) {
+	stream, client := setupStream(t, 0)
+	defer client.Close()
+
+	tests := []packet.Packet{
+		packet.NewStringMessage("Hello ❤"),
+		packet.NewBinaryMessage([]byte{1, 2, 3}),
+		packet.NewPing([]byte("probe")),
+	}
+
+	for _, test := range tests {
+		go codec.Framed{}.Encode(packet.Payload{test}, client)
+
+		received, err := stream.Receive()
+
+		assert.Nil(t, err, "error while receiving packet")
+		assert.Equal(t, test, received, "packet was not received from client")
+	}
+}
+
+func TestStreamPayloadTooLarge(t *testing.T) {
+	stream, client := setupStream(t, 5)
+	defer client.Close()
+
+	go codec.Framed{}.Encode(packet.Payload{packet.NewStringMessage("hello world")}, client)
+
+	_, err := stream.Receive()
+
+	assert.Equal(t, transport.ErrPayloadTooLarge, err, "oversized payload error was not returned")
+	assert.False(t, stream.Running(), "transport was not shut down")
+}
+
+func TestStreamShutdownDuringReceive(t *testing.T) {
+	stream, client := setupStream(t, 0)
+	defer client.Close()
+
+	result := make(chan error)
+
+	go func() {
+		_, err := stream.Receive()
+		result <- err
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+
+	stream.Shutdown()
+
+	select {
+	case err := <-result:
+		assert.Error(t, err, "error was not returned from receive interrupted by shutdown")
+	case <-time.After(time.Second):
+		t.Error("shutdown did not interrupt pending receive")
+	}
+
+	assert.Error(t, stream.Send(packet.NewNOOP()), "packet was sent after shutdown")
+}
+
+func TestStreamUnavailable(t *testing.T) {
+	failing := func(writer http.ResponseWriter, request *http.Request) (io.ReadWriter, func(), error) {
+		writer.WriteHeader(http.StatusBadRequest)
+
+		return nil, nil, errors.New("upgrade failed")
+	}
+
+	tests := []struct {
+		originCheck func(*http.Request) bool
+		status      int
+	}{
+		{nil, http.StatusBadRequest},
+		{func(*http.Request) bool { return false }, http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		stream := transport.NewStream("stream", failing, 0, test.originCheck)
+
+		request, _ := http.NewRequest("CONNECT", "/", nil)
+		writer := httptest.NewRecorder()
+
+		stream.HandleRequest(writer, request)
+
+		assert.Equal(t, test.status, writer.Code, "wrong status of unavailable transport")
+		assert.False(t, stream.Running(), "unavailable transport is running")
+		assert.Error(t, stream.Send(packet.NewNOOP()), "packet was sent by unavailable transport")
+	}
+}
+
+// setupStream upgrades a request to one end of a pipe
+// and returns the client end after the open packet is sent
+func setupStream(t *testing.T, maxBufferSize int64) (*transport.Stream, net.Conn) {
+	server, client := net.Pipe()
+
+	upgrader := func(writer http.ResponseWriter, request *http.Request) (io.ReadWriter, func(), error) {
+		return server, func() { server.Close() }, nil
+	}
+
+	stream := transport.NewStream("stream", upgrader, maxBufferSize, nil)
+
+	request, _ := http.NewRequest("CONNECT", "/", nil)
+
+	go codec.Framed{}.Encode(packet.Payload{{Type: packet.Open}}, client)
+
+	stream.HandleRequest(httptest.NewRecorder(), request)
+
+	assert.True(t, stream.Running(), "stream was not opened")
+
+	return stream, client
+}
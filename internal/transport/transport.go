@@ -1,49 +1,94 @@
 package transport
 
 import (
+	"context"
+	"errors"
 	"net/http"
 
+	"github.com/byonchev/go-engine.io/internal/codec"
 	"github.com/byonchev/go-engine.io/internal/config"
 	"github.com/byonchev/go-engine.io/internal/packet"
+	"github.com/byonchev/go-engine.io/internal/protocol"
 )
 
 // String identifiers for each supported transport
 const (
-	WebsocketType = "websocket"
-	PollingType   = "polling"
+	WebsocketType    = "websocket"
+	PollingType      = "polling"
+	WebTransportType = "webtransport"
+	SSEType          = "sse"
+	RawType          = "raw"
 )
 
-// Transport handles the delivery of packets between the client and the server
+// ErrPayloadTooLarge is returned on receive after the client sent payload
+// exceeding the maximum buffer size. The transport is shut down
+var ErrPayloadTooLarge = errors.New("payload too large")
+
+// ErrPollOverlap is returned on receive after the client sent a polling request
+// while another one with the same method was pending. The transport is shut down
+var ErrPollOverlap = errors.New("overlapping polling requests")
+
+// Transport handles the delivery of packets between the client and the server.
+// Receive blocks until a packet arrives. Once the transport is shut down,
+// Receive returns an error and Running reports false
 type Transport interface {
 	Type() string
-	Upgrades() []string
 
 	HandleRequest(http.ResponseWriter, *http.Request)
 
 	Send(packet.Packet) error
 	Receive() (packet.Packet, error)
+	Drain(context.Context) error
 
-	Shutdown()
+	// Shutdown stops the transport and returns the packets that were sent
+	// but not delivered to the client
+	Shutdown() packet.Payload
 	Running() bool
 }
 
-// NewTransport creates a transport of the selected type
-func NewTransport(name string, config config.Config) Transport {
+// Buffered is implemented by transports which keep the sent packets
+// until a client request delivers them
+type Buffered interface {
+	// OnFlush sets the handler called after buffered packets are written to the client
+	OnFlush(func())
+}
+
+// CreatePolling creates polling transport configured with the session settings
+func CreatePolling(protocol protocol.Version, config config.Config) Transport {
+	flushLimit := config.PollingBufferFlushLimit
+	receiveLimit := config.PollingBufferReceiveLimit
+	compression := config.HTTPCompression
+	compressionThreshold := config.HTTPCompressionThreshold
+	maxBufferSize := config.MaxHTTPBufferSize
+	originCheck := config.CheckOrigin
+
+	return NewPolling(protocol, flushLimit, receiveLimit, compression, compressionThreshold, maxBufferSize, originCheck)
+}
+
+// CreateWebsocket creates websocket transport configured with the session settings
+func CreateWebsocket(protocol protocol.Version, config config.Config) Transport {
+	readBufferSize := config.WebsocketReadBufferSize
+	writeBufferSize := config.WebsocketWriteBufferSize
+	compression := config.PerMessageDeflate
+	maxBufferSize := config.MaxHTTPBufferSize
 	originCheck := config.CheckOrigin
 
-	switch name {
-	case WebsocketType:
-		readBufferSize := config.WebsocketReadBufferSize
-		writeBufferSize := config.WebsocketWriteBufferSize
-		enableCompression := config.PerMessageDeflate
-
-		return NewWebsocket(readBufferSize, writeBufferSize, enableCompression, originCheck)
-	case PollingType:
-		flushLimit := config.PollingBufferFlushLimit
-		receiveLimit := config.PollingBufferReceiveLimit
-
-		return NewPolling(flushLimit, receiveLimit, originCheck)
-	default:
-		return nil
-	}
+	return NewWebsocket(protocol, readBufferSize, writeBufferSize, compression, maxBufferSize, originCheck)
+}
+
+// CreateSSE creates event stream transport configured with the session settings
+func CreateSSE(protocol protocol.Version, config config.Config) Transport {
+	flushLimit := config.PollingBufferFlushLimit
+	receiveLimit := config.PollingBufferReceiveLimit
+	maxBufferSize := config.MaxHTTPBufferSize
+	originCheck := config.CheckOrigin
+
+	return NewSSE(protocol, flushLimit, receiveLimit, maxBufferSize, originCheck)
+}
+
+// isDecodeError returns true if the client sent malformed payload
+func isDecodeError(err error) bool {
+	var decodeError *codec.DecodeError
+
+	return errors.As(err, &decodeError)
 }
@@ -1,44 +1,56 @@
 package transport
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"io"
 	"net/http"
 	"sync"
 
 	"github.com/byonchev/go-engine.io/internal/codec"
+	"github.com/byonchev/go-engine.io/internal/config"
 	"github.com/byonchev/go-engine.io/internal/logger"
 	"github.com/byonchev/go-engine.io/internal/packet"
+	"github.com/byonchev/go-engine.io/internal/protocol"
 	"github.com/gorilla/websocket"
 )
 
+// preparedKey identifies the websocket message prepared from a shared packet
+type preparedKey struct {
+	protocol    protocol.Version
+	messageType int
+}
+
 // Websocket handles protocol upgrade and transmission over websockets
 type Websocket struct {
-	readBufferSize    int
-	writeBufferSize   int
-	enableCompression bool
-	originCheck       func(*http.Request) bool
+	protocol        protocol.Version
+	readBufferSize  int
+	writeBufferSize int
+	compression     config.PerMessageDeflate
+	maxBufferSize   int64
+	originCheck     func(*http.Request) bool
 
 	writeLock sync.Mutex
 	readLock  sync.Mutex
 
-	running bool
+	stateLock sync.RWMutex
+	running   bool
 
 	socket *websocket.Conn
-
-	codec codec.Codec
 }
 
 // NewWebsocket creates new Websocket transport
-func NewWebsocket(readBufferSize int, writeBufferSize int, enableCompression bool, originCheck func(*http.Request) bool) *Websocket {
+func NewWebsocket(protocol protocol.Version, readBufferSize int, writeBufferSize int, compression config.PerMessageDeflate, maxBufferSize int64, originCheck func(*http.Request) bool) *Websocket {
 	transport := &Websocket{
-		readBufferSize:    readBufferSize,
-		writeBufferSize:   writeBufferSize,
-		enableCompression: enableCompression,
-		originCheck:       originCheck,
+		protocol:        protocol,
+		readBufferSize:  readBufferSize,
+		writeBufferSize: writeBufferSize,
+		compression:     compression,
+		maxBufferSize:   maxBufferSize,
+		originCheck:     originCheck,
 
 		running: false,
-		codec:   codec.Websocket{},
 	}
 
 	transport.lock()
@@ -50,10 +62,11 @@ func NewWebsocket(readBufferSize int, writeBufferSize int, enableCompression boo
 func (transport *Websocket) HandleRequest(writer http.ResponseWriter, request *http.Request) {
 	defer transport.unlock()
 
+	// the upgrader negotiates the extension without context takeover
 	upgrader := websocket.Upgrader{
 		ReadBufferSize:    transport.readBufferSize,
 		WriteBufferSize:   transport.writeBufferSize,
-		EnableCompression: transport.enableCompression,
+		EnableCompression: transport.compression.Enabled,
 		CheckOrigin:       transport.originCheck,
 	}
 
@@ -64,16 +77,31 @@ func (transport *Websocket) HandleRequest(writer http.ResponseWriter, request *h
 		return
 	}
 
+	if transport.maxBufferSize > 0 {
+		socket.SetReadLimit(transport.maxBufferSize)
+	}
+
+	if transport.compression.Level != 0 {
+		err = socket.SetCompressionLevel(transport.compression.Level)
+
+		if err != nil {
+			logger.Error("Invalid websocket compression level: ", err)
+		}
+	}
+
 	transport.socket = socket
-	transport.running = true
+	transport.setRunning(true)
 }
 
-// Shutdown closes the client socket
-func (transport *Websocket) Shutdown() {
-	transport.lock()
-	defer transport.unlock()
+// Shutdown closes the client socket and interrupts pending receive.
+// Sent packets are written immediately, so none are returned
+func (transport *Websocket) Shutdown() packet.Payload {
+	transport.writeLock.Lock()
+	defer transport.writeLock.Unlock()
 
 	transport.close()
+
+	return nil
 }
 
 // Send writes packet to the client socket
@@ -81,7 +109,7 @@ func (transport *Websocket) Send(message packet.Packet) error {
 	transport.writeLock.Lock()
 	defer transport.writeLock.Unlock()
 
-	if !transport.running {
+	if !transport.Running() {
 		return errors.New("transport not running")
 	}
 
@@ -93,6 +121,15 @@ func (transport *Websocket) Send(message packet.Packet) error {
 		messageType = websocket.TextMessage
 	}
 
+	// small messages are not worth the compression overhead
+	compress := transport.compression.Enabled && len(message.Data) >= transport.compression.Threshold
+
+	transport.socket.EnableWriteCompression(compress)
+
+	if message.Cache != nil {
+		return transport.sendPrepared(message, messageType)
+	}
+
 	writer, err := transport.socket.NextWriter(messageType)
 
 	if err != nil {
@@ -101,7 +138,7 @@ func (transport *Websocket) Send(message packet.Packet) error {
 
 	payload := packet.Payload{message}
 
-	err = transport.codec.Encode(payload, writer)
+	err = transport.createCodec(messageType).Encode(payload, writer)
 
 	if err != nil {
 		return err
@@ -110,16 +147,27 @@ func (transport *Websocket) Send(message packet.Packet) error {
 	return writer.Close()
 }
 
+// Drain returns immediately, because packets are written to the socket on send
+func (transport *Websocket) Drain(ctx context.Context) error {
+	return nil
+}
+
 // Receive receives the next packet from the client socket
 func (transport *Websocket) Receive() (packet.Packet, error) {
 	transport.readLock.Lock()
 	defer transport.readLock.Unlock()
 
-	if !transport.running {
+	if !transport.Running() {
 		return packet.Packet{}, io.EOF
 	}
 
-	_, reader, err := transport.socket.NextReader()
+	messageType, reader, err := transport.socket.NextReader()
+
+	if err == websocket.ErrReadLimit {
+		transport.close()
+
+		return packet.Packet{}, ErrPayloadTooLarge
+	}
 
 	if err != nil {
 		transport.close()
@@ -127,7 +175,13 @@ func (transport *Websocket) Receive() (packet.Packet, error) {
 		return packet.Packet{}, io.EOF
 	}
 
-	payload, err := transport.codec.Decode(reader)
+	payload, err := transport.createCodec(messageType).Decode(reader)
+
+	if err == websocket.ErrReadLimit {
+		transport.close()
+
+		return packet.Packet{}, ErrPayloadTooLarge
+	}
 
 	if err != nil {
 		return packet.Packet{}, err
@@ -146,6 +200,9 @@ func (transport *Websocket) Receive() (packet.Packet, error) {
 
 // Running returns true if the transport is active
 func (transport *Websocket) Running() bool {
+	transport.stateLock.RLock()
+	defer transport.stateLock.RUnlock()
+
 	return transport.running
 }
 
@@ -154,14 +211,60 @@ func (transport *Websocket) Type() string {
 	return WebsocketType
 }
 
-// Upgrades returns the possible transport upgrades
-func (transport *Websocket) Upgrades() []string {
-	return []string{}
+// sendPrepared writes packet sent to multiple sessions, so its frames
+// are encoded and compressed once for all sockets with the same settings
+func (transport *Websocket) sendPrepared(message packet.Packet, messageType int) error {
+	key := preparedKey{transport.protocol, messageType}
+
+	prepared := message.Cache.Value(key, func() interface{} {
+		var buffer bytes.Buffer
+
+		// the cache is locked while the message is prepared
+		unshared := message
+		unshared.Cache = nil
+
+		err := transport.createCodec(messageType).Encode(packet.Payload{unshared}, &buffer)
+
+		if err != nil {
+			return err
+		}
+
+		prepared, err := websocket.NewPreparedMessage(messageType, buffer.Bytes())
+
+		if err != nil {
+			return err
+		}
+
+		return prepared
+	})
+
+	if err, failed := prepared.(error); failed {
+		return err
+	}
+
+	return transport.socket.WritePreparedMessage(prepared.(*websocket.PreparedMessage))
+}
+
+func (transport *Websocket) createCodec(messageType int) codec.Codec {
+	return codec.Websocket{
+		Protocol:    transport.protocol,
+		BinaryFrame: messageType == websocket.BinaryMessage,
+	}
+}
+
+func (transport *Websocket) setRunning(running bool) {
+	transport.stateLock.Lock()
+	defer transport.stateLock.Unlock()
+
+	transport.running = running
 }
 
 func (transport *Websocket) close() {
-	transport.running = false
-	transport.socket.Close()
+	transport.setRunning(false)
+
+	if transport.socket != nil {
+		transport.socket.Close()
+	}
 }
 
 func (transport *Websocket) lock() {
@@ -2,13 +2,21 @@ package transport_test
 
 import (
 	"bytes"
+	"compress/flate"
+	"io"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/byonchev/go-engine.io/internal/codec"
+	"github.com/byonchev/go-engine.io/internal/config"
 	"github.com/byonchev/go-engine.io/internal/packet"
+	"github.com/byonchev/go-engine.io/internal/protocol"
 	"github.com/byonchev/go-engine.io/internal/transport"
 	"github.com/gorilla/websocket"
 	"github.com/stretchr/testify/assert"
@@ -74,6 +82,29 @@ func TestWebsocketReceive(t *testing.T) {
 	}
 }
 
+func TestWebsocketBinaryV4(t *testing.T) {
+	transport := transport.NewWebsocket(protocol.V4, 1024, 1024, config.PerMessageDeflate{}, 0, func(*http.Request) bool { return true })
+	server := createServer(transport)
+	client := connectClient(server)
+	defer server.Close()
+
+	sent := packet.NewBinaryMessage([]byte{1, 2, 3})
+
+	transport.Send(sent)
+
+	messageType, data, _ := client.ReadMessage()
+
+	assert.Equal(t, websocket.BinaryMessage, messageType, "wrong message type received by client")
+	assert.Equal(t, sent.Data, data, "binary frame contains packet type")
+
+	client.WriteMessage(websocket.BinaryMessage, []byte{4, 5, 6})
+
+	received, err := transport.Receive()
+
+	assert.NoError(t, err, "error while receiving binary frame")
+	assert.Equal(t, packet.NewBinaryMessage([]byte{4, 5, 6}), received, "binary frame was not received as message")
+}
+
 func TestWebsocketSendAfterShutdown(t *testing.T) {
 	_, transport, server, client := setupWebsockets()
 	defer server.Close()
@@ -104,6 +135,44 @@ func TestWebsocketReceiveAfterShutdown(t *testing.T) {
 	assert.Equal(t, packet.Packet{}, actual, "packet was received from client after shutdown")
 }
 
+func TestWebsocketShutdownDuringReceive(t *testing.T) {
+	_, transport, server, _ := setupWebsockets()
+	defer server.Close()
+
+	result := make(chan error)
+
+	go func() {
+		_, err := transport.Receive()
+		result <- err
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+
+	transport.Shutdown()
+
+	select {
+	case err := <-result:
+		assert.Error(t, err, "error was not returned from receive interrupted by shutdown")
+	case <-time.After(time.Second):
+		t.Error("shutdown did not interrupt pending receive")
+	}
+}
+
+func TestWebsocketPayloadTooLarge(t *testing.T) {
+	limited := transport.NewWebsocket(protocol.V3, 1024, 1024, config.PerMessageDeflate{}, 5, func(*http.Request) bool { return true })
+	server := createServer(limited)
+	defer server.Close()
+
+	client := connectClient(server)
+
+	client.WriteMessage(websocket.TextMessage, []byte("4hello world"))
+
+	_, err := limited.Receive()
+
+	assert.Equal(t, transport.ErrPayloadTooLarge, err, "oversized payload error was not returned")
+	assert.False(t, limited.Running(), "transport was not shut down")
+}
+
 func TestWebsocketUpgradeError(t *testing.T) {
 	transport := createWebsocketTransport()
 
@@ -115,8 +184,184 @@ func TestWebsocketUpgradeError(t *testing.T) {
 	assert.Equal(t, http.StatusBadRequest, writer.Code, "upgrade failure doesn't return 400")
 }
 
+func TestWebsocketCompressionThreshold(t *testing.T) {
+	tests := []struct {
+		size       int
+		compressed bool
+	}{
+		{10, false},
+		{2048, true},
+	}
+
+	for _, test := range tests {
+		compression := config.PerMessageDeflate{Enabled: true, Threshold: 1024, Level: flate.BestSpeed}
+		websocketTransport := transport.NewWebsocket(protocol.V3, 1024, 1024, compression, 0, nil)
+
+		server := createServer(websocketTransport)
+
+		recorder := &recordingConn{}
+
+		dialer := websocket.Dialer{
+			EnableCompression: true,
+			NetDial: func(network string, address string) (net.Conn, error) {
+				conn, err := net.Dial(network, address)
+				recorder.Conn = conn
+
+				return recorder, err
+			},
+		}
+
+		client, response, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+
+		assert.Nil(t, err, "client did not connect")
+		assert.Contains(t, response.Header.Get("Sec-WebSocket-Extensions"), "server_no_context_takeover", "context takeover was negotiated")
+
+		message := packet.NewStringMessage(strings.Repeat("a", test.size))
+
+		websocketTransport.Send(message)
+
+		_, data, _ := client.ReadMessage()
+
+		assert.Equal(t, "4"+string(message.Data), string(data), "message was not received")
+
+		frames := recorder.read.Bytes()
+		header := frames[bytes.Index(frames, []byte("\r\n\r\n"))+4]
+
+		assert.Equal(t, test.compressed, header&0x40 != 0, "wrong compression of message with size "+strconv.Itoa(test.size))
+
+		client.Close()
+		server.Close()
+	}
+}
+
+func TestWebsocketSendBroadcast(t *testing.T) {
+	message := packet.NewBroadcast(false, []byte(strings.Repeat("a", 2048)))
+
+	tests := []struct {
+		compression config.PerMessageDeflate
+		compressed  bool
+	}{
+		{config.PerMessageDeflate{Enabled: true, Level: flate.BestSpeed}, true},
+		{config.PerMessageDeflate{}, false},
+		{config.PerMessageDeflate{Enabled: true, Level: flate.BestSpeed}, true},
+	}
+
+	for _, test := range tests {
+		websocketTransport := transport.NewWebsocket(protocol.V4, 1024, 1024, test.compression, 0, nil)
+
+		server := createServer(websocketTransport)
+
+		recorder := &recordingConn{}
+
+		dialer := websocket.Dialer{
+			EnableCompression: true,
+			NetDial: func(network string, address string) (net.Conn, error) {
+				conn, err := net.Dial(network, address)
+				recorder.Conn = conn
+
+				return recorder, err
+			},
+		}
+
+		client, _, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+
+		assert.Nil(t, err, "client did not connect")
+
+		err = websocketTransport.Send(message)
+
+		assert.Nil(t, err, "broadcast was not sent")
+
+		messageType, data, _ := client.ReadMessage()
+
+		assert.Equal(t, websocket.TextMessage, messageType, "wrong message type received by client")
+		assert.Equal(t, "4"+string(message.Data), string(data), "broadcast was not received")
+
+		frames := recorder.read.Bytes()
+		header := frames[bytes.Index(frames, []byte("\r\n\r\n"))+4]
+
+		assert.Equal(t, test.compressed, header&0x40 != 0, "wrong compression of broadcast")
+
+		client.Close()
+		server.Close()
+	}
+}
+
+// BenchmarkWebsocketSendBroadcast compares compressing a message for each socket
+// with sending a broadcast prepared once for all sockets
+func BenchmarkWebsocketSendBroadcast(b *testing.B) {
+	const recipients = 10
+
+	compression := config.PerMessageDeflate{Enabled: true, Level: flate.BestSpeed}
+	dialer := websocket.Dialer{EnableCompression: true}
+
+	var transports []*transport.Websocket
+
+	for i := 0; i < recipients; i++ {
+		websocketTransport := transport.NewWebsocket(protocol.V4, 1024, 1024, compression, 0, nil)
+
+		server := createServer(websocketTransport)
+		defer server.Close()
+
+		client, _, _ := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+		defer client.Close()
+
+		go func() {
+			for {
+				_, reader, err := client.NextReader()
+
+				if err != nil {
+					return
+				}
+
+				io.Copy(ioutil.Discard, reader)
+			}
+		}()
+
+		transports = append(transports, websocketTransport)
+	}
+
+	messages := []struct {
+		name   string
+		create func(bool, []byte) packet.Packet
+	}{
+		{"per-recipient", packet.NewMessage},
+		{"prepared", packet.NewBroadcast},
+	}
+
+	data := []byte(strings.Repeat("hello world ", 100))
+
+	for _, message := range messages {
+		b.Run(message.name, func(b *testing.B) {
+			b.ReportAllocs()
+
+			for n := 0; n < b.N; n++ {
+				broadcast := message.create(false, data)
+
+				for _, websocketTransport := range transports {
+					websocketTransport.Send(broadcast)
+				}
+			}
+		})
+	}
+}
+
+// recordingConn keeps the bytes read from the connection
+type recordingConn struct {
+	net.Conn
+
+	read bytes.Buffer
+}
+
+func (conn *recordingConn) Read(data []byte) (int, error) {
+	n, err := conn.Conn.Read(data)
+
+	conn.read.Write(data[:n])
+
+	return n, err
+}
+
 func createWebsocketTransport() *transport.Websocket {
-	return transport.NewWebsocket(1024, 1024, false, func(*http.Request) bool { return true })
+	return transport.NewWebsocket(protocol.V3, 1024, 1024, config.PerMessageDeflate{}, 0, func(*http.Request) bool { return true })
 }
 
 func createServer(transport *transport.Websocket) *httptest.Server {
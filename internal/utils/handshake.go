@@ -2,27 +2,38 @@ package utils
 
 import (
 	"encoding/json"
+	"errors"
 	"time"
 
 	"github.com/byonchev/go-engine.io/internal/config"
 	"github.com/byonchev/go-engine.io/internal/packet"
-	"github.com/byonchev/go-engine.io/internal/transport"
+	"github.com/byonchev/go-engine.io/internal/protocol"
 )
 
-type handshakeMessage struct {
+// Handshake is the message sent to the client in the open packet
+type Handshake struct {
 	SessionID    string   `json:"sid"`
 	Upgrades     []string `json:"upgrades"`
 	PingTimeout  int64    `json:"pingTimeout"`
 	PingInterval int64    `json:"pingInterval"`
+	MaxPayload   int64    `json:"maxPayload,omitempty"`
 }
 
 // CreateHandshakePacket creates open packet with JSON serialized handshake messag
-func CreateHandshakePacket(sid string, transport transport.Transport, config config.Config) packet.Packet {
-	handshake := handshakeMessage{
+func CreateHandshakePacket(sid string, version protocol.Version, upgrades []string, config config.Config) packet.Packet {
+	if upgrades == nil {
+		upgrades = []string{}
+	}
+
+	handshake := Handshake{
 		SessionID:    sid,
 		PingInterval: int64(config.PingInterval / time.Millisecond),
 		PingTimeout:  int64(config.PingTimeout / time.Millisecond),
-		Upgrades:     getSupportedUpgrades(transport, config),
+		Upgrades:     upgrades,
+	}
+
+	if version == protocol.V4 {
+		handshake.MaxPayload = config.MaxHTTPBufferSize
 	}
 
 	json, _ := json.Marshal(handshake)
@@ -30,18 +41,23 @@ func CreateHandshakePacket(sid string, transport transport.Transport, config con
 	return packet.NewOpen(json)
 }
 
-func getSupportedUpgrades(transport transport.Transport, config config.Config) []string {
-	result := []string{}
+// ParseHandshakePacket decodes the handshake message of an open packet
+func ParseHandshakePacket(open packet.Packet) (Handshake, error) {
+	var handshake Handshake
+
+	if open.Type != packet.Open {
+		return handshake, errors.New("open packet expected")
+	}
+
+	err := json.Unmarshal(open.Data, &handshake)
 
-	if !config.AllowUpgrades {
-		return result
+	if err != nil {
+		return handshake, err
 	}
 
-	for _, upgrade := range transport.Upgrades() {
-		if StringSliceContains(config.Transports, upgrade) {
-			result = append(result, upgrade)
-		}
+	if handshake.SessionID == "" {
+		return handshake, errors.New("session ID missing")
 	}
 
-	return result
+	return handshake, nil
 }
@@ -6,7 +6,7 @@ import (
 
 	"github.com/byonchev/go-engine.io/internal/config"
 	"github.com/byonchev/go-engine.io/internal/packet"
-	"github.com/byonchev/go-engine.io/internal/transport"
+	"github.com/byonchev/go-engine.io/internal/protocol"
 	"github.com/byonchev/go-engine.io/internal/utils"
 	"github.com/stretchr/testify/assert"
 )
@@ -25,7 +25,7 @@ func TestHandshakePacket(t *testing.T) {
 		Data:   []byte("{\"sid\":\"100200300\",\"upgrades\":[\"websocket\"],\"pingTimeout\":2000,\"pingInterval\":1000}"),
 	}
 
-	actual := utils.CreateHandshakePacket("100200300", &transport.Polling{}, config)
+	actual := utils.CreateHandshakePacket("100200300", protocol.V3, []string{"websocket"}, config)
 
 	assert.Equal(t, expected, actual, "handshake packet is invalid")
 }
@@ -44,7 +44,72 @@ func TestNotUpgradablePacket(t *testing.T) {
 		Data:   []byte("{\"sid\":\"100200300\",\"upgrades\":[],\"pingTimeout\":2000,\"pingInterval\":1000}"),
 	}
 
-	actual := utils.CreateHandshakePacket("100200300", &transport.Polling{}, config)
+	actual := utils.CreateHandshakePacket("100200300", protocol.V3, nil, config)
 
 	assert.Equal(t, expected, actual, "handshake packet is invalid")
 }
+
+func TestHandshakePacketV4(t *testing.T) {
+	config := config.Config{
+		PingInterval:      1 * time.Second,
+		PingTimeout:       2 * time.Second,
+		MaxHTTPBufferSize: 1000,
+		Transports:        []string{"polling", "websocket"},
+		AllowUpgrades:     true,
+	}
+
+	expected := packet.Packet{
+		Binary: false,
+		Type:   packet.Open,
+		Data:   []byte("{\"sid\":\"100200300\",\"upgrades\":[\"websocket\"],\"pingTimeout\":2000,\"pingInterval\":1000,\"maxPayload\":1000}"),
+	}
+
+	actual := utils.CreateHandshakePacket("100200300", protocol.V4, []string{"websocket"}, config)
+
+	assert.Equal(t, expected, actual, "handshake packet is invalid")
+}
+
+func TestHandshakePacketMaxBufferSize(t *testing.T) {
+	config := config.Config{
+		MaxHTTPBufferSize: 2000,
+	}
+
+	handshake, _ := utils.ParseHandshakePacket(utils.CreateHandshakePacket("100200300", protocol.V4, []string{"websocket"}, config))
+
+	assert.Equal(t, int64(2000), handshake.MaxPayload, "buffer size was not advertised as max payload")
+}
+
+func TestParseHandshakePacket(t *testing.T) {
+	config := config.Config{
+		PingInterval:      1 * time.Second,
+		PingTimeout:       2 * time.Second,
+		MaxHTTPBufferSize: 1000,
+		Transports:        []string{"polling", "websocket"},
+		AllowUpgrades:     true,
+	}
+
+	expected := utils.Handshake{
+		SessionID:    "100200300",
+		Upgrades:     []string{"websocket"},
+		PingTimeout:  2000,
+		PingInterval: 1000,
+		MaxPayload:   1000,
+	}
+
+	actual, err := utils.ParseHandshakePacket(utils.CreateHandshakePacket("100200300", protocol.V4, []string{"websocket"}, config))
+
+	assert.Nil(t, err, "error while parsing handshake packet")
+	assert.Equal(t, expected, actual, "handshake packet was not parsed properly")
+
+	invalid := []packet.Packet{
+		packet.NewStringMessage("{}"),
+		packet.NewOpen([]byte("{")),
+		packet.NewOpen([]byte("{}")),
+	}
+
+	for _, test := range invalid {
+		_, err := utils.ParseHandshakePacket(test)
+
+		assert.Error(t, err, "error was expected for parsing "+test.String())
+	}
+}
@@ -1,18 +1,30 @@
 package eio
 
 import (
+	"context"
 	"errors"
+	"net"
 	"net/http"
+	"net/http/httputil"
 	"net/url"
 	"sync"
 	"time"
 
 	"github.com/byonchev/go-engine.io/internal/config"
+	"github.com/byonchev/go-engine.io/internal/heartbeat"
 	"github.com/byonchev/go-engine.io/internal/logger"
 	"github.com/byonchev/go-engine.io/internal/packet"
+	"github.com/byonchev/go-engine.io/internal/protocol"
 	"github.com/byonchev/go-engine.io/internal/transport"
 )
 
+// forwardedHeader marks requests forwarded to the session owner to prevent forwarding loops
+const forwardedHeader = "X-Engine-IO-Forwarded"
+
+// PerMessageDeflate holds the settings of the websocket permessage-deflate extension.
+// Context takeover is not supported, every message is compressed with a new context
+type PerMessageDeflate = config.PerMessageDeflate
+
 // Server defines engine.io http endpoint and holds connected clients
 type Server struct {
 	config.Config
@@ -21,48 +33,91 @@ type Server struct {
 
 	clients map[string]*Session
 
-	events chan interface{}
+	transports *transport.Registry
+
+	store   SessionStore
+	address string
+
+	adapter Adapter
+
+	scheduler *heartbeat.Scheduler
+
+	connectionHandlers []func(*Socket)
+
+	events       chan interface{}
+	eventsOnce   sync.Once
+	eventsLock   sync.RWMutex
+	eventsClosed bool
+
+	closing bool
+	done    chan struct{}
 }
 
 // NewServer creates a new engine server
 func NewServer() *Server {
 	server := &Server{
-		clients: make(map[string]*Session),
-		events:  make(chan interface{}),
+		clients:    make(map[string]*Session),
+		transports: transport.NewRegistry(),
+		store:      NewMemoryStore(),
+		scheduler:  heartbeat.NewScheduler(),
+		done:       make(chan struct{}),
 
 		Config: config.Config{
 			PingInterval:              25 * time.Second,
 			PingTimeout:               60 * time.Second,
+			MaxHTTPBufferSize:         1000000,
 			Transports:                []string{transport.PollingType, transport.WebsocketType},
 			AllowUpgrades:             true,
 			UpgradeTimeout:            10 * time.Second,
 			PollingBufferFlushLimit:   10,
 			PollingBufferReceiveLimit: 10,
+			HTTPCompression:           true,
+			HTTPCompressionThreshold:  1024,
 			WebsocketReadBufferSize:   1024,
 			WebsocketWriteBufferSize:  1024,
-			PerMessageDeflate:         true,
+			PerMessageDeflate:         PerMessageDeflate{Enabled: true, Threshold: 1024},
+			EventQueueSize:            100,
+			EventQueueOverflow:        OverflowBlock,
 			CheckOrigin:               func(*http.Request) bool { return true },
 		},
 	}
 
-	go server.checkPing()
+	server.adapter = NewMemoryAdapter(server)
 
 	return server
 }
 
 func (server *Server) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
-	defer request.Body.Close()
+	defer closeBody(request)
 
 	sessionID := request.URL.Query().Get("sid")
 
 	var client *Session
 
 	if sessionID == "" {
-		client = server.createSession(request.URL.Query())
+		version, err := protocol.Parse(request.URL.Query().Get("EIO"))
+
+		if err != nil {
+			logger.Error("Handshake error: ", err)
+			writer.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		client, err = server.createSession(version)
+
+		if err != nil {
+			logger.Error("Handshake error: ", err)
+			writer.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
 	} else {
 		client = server.findSession(sessionID)
 	}
 
+	if client == nil && server.forwardRequest(writer, request, sessionID) {
+		return
+	}
+
 	if client == nil {
 		logger.Error("Session ", sessionID, " not found")
 		return
@@ -71,22 +126,189 @@ func (server *Server) ServeHTTP(writer http.ResponseWriter, request *http.Reques
 	client.HandleRequest(writer, request)
 }
 
-// Events returns the channel for session events
+// Serve accepts TCP or Unix socket connections from the listener and opens
+// a protocol v4 session for each one, exchanging length-prefixed packets without HTTP.
+// It returns the error of the listener, which is closed by the caller
+func (server *Server) Serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+
+		if err != nil {
+			return err
+		}
+
+		go server.serveConn(conn)
+	}
+}
+
+// OnConnection registers handler for new client connections.
+// Socket handlers should be registered before the connection handler returns
+func (server *Server) OnConnection(handler func(*Socket)) {
+	server.Lock()
+	defer server.Unlock()
+
+	server.connectionHandlers = append(server.connectionHandlers, handler)
+}
+
+// Events returns the channel for session events.
+// The channel is fed by connection and socket handlers registered on the first call.
+// Sessions connected before the first call start with a connect event.
+// Events of a single session are delivered in order
 func (server *Server) Events() <-chan interface{} {
+	server.eventsOnce.Do(func() {
+		server.eventsLock.Lock()
+		defer server.eventsLock.Unlock()
+
+		server.events = make(chan interface{})
+
+		if server.eventsClosed {
+			close(server.events)
+			return
+		}
+
+		server.Lock()
+		defer server.Unlock()
+
+		server.connectionHandlers = append(server.connectionHandlers, server.forwardEvents)
+
+		for _, session := range server.clients {
+			server.attachEvents(session)
+		}
+	})
+
 	return server.events
 }
 
 // Send sends message to a specific session
 func (server *Server) Send(id string, binary bool, data []byte) error {
-	server.RLock()
-	session := server.findSession(id)
-	server.RUnlock()
+	return server.sendPacket(id, packet.NewMessage(binary, data))
+}
+
+// Broadcast sends message to all sessions reachable through the adapter
+func (server *Server) Broadcast(binary bool, data []byte) error {
+	return server.broadcastOperator().Send(binary, data)
+}
+
+// To selects the sessions in the rooms as broadcast recipients
+func (server *Server) To(rooms ...string) BroadcastOperator {
+	return server.broadcastOperator().To(rooms...)
+}
+
+// Except excludes the sessions in the rooms from broadcast recipients
+func (server *Server) Except(rooms ...string) BroadcastOperator {
+	return server.broadcastOperator().Except(rooms...)
+}
+
+// Join adds the session to the room. Sessions leave all rooms on disconnect
+func (server *Server) Join(id string, room string) error {
+	if server.findSession(id) == nil {
+		return errors.New("invalid session")
+	}
+
+	adapter := server.getAdapter()
+
+	err := adapter.Join(id, room)
+
+	if err != nil {
+		return err
+	}
+
+	if server.findSession(id) == nil {
+		server.leaveRooms(id, adapter)
 
-	if session == nil {
 		return errors.New("invalid session")
 	}
 
-	return session.Send(packet.NewMessage(binary, data))
+	return nil
+}
+
+// Leave removes the session from the room
+func (server *Server) Leave(id string, room string) error {
+	return server.getAdapter().Leave(id, room)
+}
+
+// Shutdown stops accepting new sessions, sends close packets to all connected clients
+// and closes the sessions after their buffered packets are delivered or the context is done.
+// The events channel is closed after all session events are handled
+func (server *Server) Shutdown(ctx context.Context) error {
+	server.Lock()
+
+	if server.closing {
+		server.Unlock()
+
+		return errors.New("server already closed")
+	}
+
+	server.closing = true
+
+	sessions := make([]*Session, 0, len(server.clients))
+
+	for _, session := range server.clients {
+		sessions = append(sessions, session)
+	}
+
+	server.Unlock()
+
+	var wait sync.WaitGroup
+
+	for _, session := range sessions {
+		wait.Add(1)
+
+		go func(session *Session) {
+			defer wait.Done()
+
+			err := session.Shutdown(ctx)
+
+			// the context error is returned to the caller once, not logged per session
+			if err != nil && err != ctx.Err() {
+				logger.Error("Session ", session.ID(), " shutdown error: ", err)
+			}
+		}(session)
+	}
+
+	wait.Wait()
+
+	err := server.waitEvents(ctx, sessions)
+
+	server.scheduler.Stop()
+	server.closeEvents()
+
+	return err
+}
+
+// Close closes all sessions without waiting for buffered packets to be delivered
+func (server *Server) Close() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := server.Shutdown(ctx)
+
+	if err == context.Canceled {
+		return nil
+	}
+
+	return err
+}
+
+// SetSessionStore replaces the store of session owners. The address is the base URL
+// under which other nodes sharing the store can reach this server.
+// Requests for sessions owned by other nodes are forwarded to the owner,
+// so the server can run behind load balancers without sticky sessions
+func (server *Server) SetSessionStore(store SessionStore, address string) {
+	server.Lock()
+	defer server.Unlock()
+
+	server.store = store
+	server.address = address
+}
+
+// SetAdapter replaces the adapter used for rooms and broadcasts.
+// It should be set before the server starts accepting connections
+func (server *Server) SetAdapter(adapter Adapter) {
+	server.Lock()
+	defer server.Unlock()
+
+	server.adapter = adapter
 }
 
 // SetLogger initializes logging with a specific implementation
@@ -94,35 +316,66 @@ func (server *Server) SetLogger(loggerInstance logger.Logger) {
 	logger.Init(loggerInstance)
 }
 
-func (server *Server) checkPing() {
-	interval := server.PingInterval + server.PingTimeout
+func (server *Server) createSession(version protocol.Version) (*Session, error) {
+	session := NewSession(server.Config, version, server.transports, server.scheduler)
+	session.onHandshake = server.joinSessionRoom
+	session.onConnect = server.connect
+	session.onClose = server.removeSession
 
-	for {
-		time.Sleep(interval)
+	server.RLock()
+	closing := server.closing
+	store := server.store
+	address := server.address
+	server.RUnlock()
 
-		server.Lock()
+	if closing {
+		return nil, errors.New("server is shutting down")
+	}
 
-		for id, session := range server.clients {
-			if session.Expired() {
-				go session.Close("ping timeout")
+	err := store.Register(session.ID(), address)
 
-				delete(server.clients, id)
-			}
+	if err != nil {
+		return nil, err
+	}
+
+	if !server.addSession(session) {
+		err = store.Remove(session.ID())
+
+		if err != nil {
+			logger.Error("Session ", session.ID(), " removal error: ", err)
 		}
 
-		server.Unlock()
+		return nil, errors.New("server is shutting down")
 	}
-}
 
-func (server *Server) createSession(params url.Values) *Session {
-	session := NewSession(server.Config, server.events)
+	return session, nil
+}
 
+// addSession adds the session to the connected clients unless the server is shutting down
+func (server *Server) addSession(session *Session) bool {
 	server.Lock()
 	defer server.Unlock()
 
+	if server.closing {
+		return false
+	}
+
 	server.clients[session.ID()] = session
 
-	return session
+	return true
+}
+
+func (server *Server) serveConn(conn net.Conn) {
+	client, err := server.createSession(protocol.V4)
+
+	if err != nil {
+		logger.Error("Handshake error: ", err)
+
+		conn.Close()
+		return
+	}
+
+	client.serve(transport.NewRaw(conn, server.MaxHTTPBufferSize))
 }
 
 func (server *Server) findSession(id string) *Session {
@@ -131,3 +384,200 @@ func (server *Server) findSession(id string) *Session {
 
 	return server.clients[id]
 }
+
+func (server *Server) removeSession(session *Session) {
+	server.Lock()
+	delete(server.clients, session.ID())
+	store := server.store
+	adapter := server.adapter
+	server.Unlock()
+
+	err := store.Remove(session.ID())
+
+	if err != nil {
+		logger.Error("Session ", session.ID(), " removal error: ", err)
+	}
+
+	server.leaveRooms(session.ID(), adapter)
+}
+
+func (server *Server) getAdapter() Adapter {
+	server.RLock()
+	defer server.RUnlock()
+
+	return server.adapter
+}
+
+func (server *Server) sendPacket(id string, message packet.Packet) error {
+	session := server.findSession(id)
+
+	if session == nil {
+		return errors.New("invalid session")
+	}
+
+	return session.Send(message)
+}
+
+// joinSessionRoom adds the session to the room named by its ID
+func (server *Server) joinSessionRoom(session *Session) {
+	err := server.getAdapter().Join(session.ID(), session.ID())
+
+	if err != nil {
+		logger.Error("Session ", session.ID(), " join error: ", err)
+	}
+}
+
+func (server *Server) broadcastOperator() BroadcastOperator {
+	return BroadcastOperator{adapter: server.getAdapter()}
+}
+
+func (server *Server) leaveRooms(sessionID string, adapter Adapter) {
+	rooms, err := adapter.Rooms(sessionID)
+
+	if err != nil {
+		logger.Error("Session ", sessionID, " rooms error: ", err)
+		return
+	}
+
+	for _, room := range rooms {
+		adapter.Leave(sessionID, room)
+	}
+}
+
+// forwardRequest proxies the request to the node owning the session.
+// Returns false if the session is not owned by another node
+func (server *Server) forwardRequest(writer http.ResponseWriter, request *http.Request, sessionID string) bool {
+	if request.Header.Get(forwardedHeader) != "" {
+		return false
+	}
+
+	server.RLock()
+	store := server.store
+	address := server.address
+	server.RUnlock()
+
+	owner, err := store.Owner(sessionID)
+
+	if err != nil || owner == "" || owner == address {
+		return false
+	}
+
+	target, err := url.Parse(owner)
+
+	if err != nil {
+		logger.Error("Invalid owner address ", owner, " for session ", sessionID)
+		return false
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Director: func(forwarded *http.Request) {
+			forwarded.URL.Scheme = target.Scheme
+			forwarded.URL.Host = target.Host
+			forwarded.Header.Set(forwardedHeader, address)
+		},
+	}
+
+	proxy.ServeHTTP(writer, request)
+
+	return true
+}
+
+func (server *Server) connect(socket *Socket) {
+	server.RLock()
+	handlers := server.connectionHandlers
+	server.RUnlock()
+
+	for _, handler := range handlers {
+		handler(socket)
+	}
+}
+
+// attachEvents forwards the events of a session created before the events channel.
+// Sessions not connected yet are attached by the connection handler instead
+func (server *Server) attachEvents(session *Session) {
+	session.events.Force(func() {
+		if session.connected() {
+			server.forwardEvents(session.socket)
+		}
+	})
+}
+
+func (server *Server) forwardEvents(socket *Socket) {
+	if !socket.startForwarding() {
+		return
+	}
+
+	id := socket.ID()
+
+	server.forward(ConnectEvent{SessionID: id})
+
+	socket.OnMessage(func(binary bool, data []byte) {
+		server.forward(MessageEvent{SessionID: id, Binary: binary, Data: data})
+	})
+
+	socket.OnUpgrade(func(transport string) {
+		server.forward(UpgradeEvent{SessionID: id, Transport: transport})
+	})
+
+	socket.OnUpgradeFailed(func(transport string, reason string) {
+		server.forward(UpgradeFailedEvent{SessionID: id, Transport: transport, Reason: reason})
+	})
+
+	socket.OnError(func(err error) {
+		server.forward(ErrorEvent{SessionID: id, Error: err})
+	})
+
+	socket.OnClose(func(reason string) {
+		server.forward(DisconnectEvent{SessionID: id, Reason: reason})
+	})
+}
+
+func (server *Server) forward(event interface{}) {
+	server.eventsLock.RLock()
+	defer server.eventsLock.RUnlock()
+
+	if server.eventsClosed {
+		return
+	}
+
+	select {
+	case server.events <- event:
+	case <-server.done:
+	}
+}
+
+func (server *Server) waitEvents(ctx context.Context, sessions []*Session) error {
+	for _, session := range sessions {
+		select {
+		case <-session.events.Done():
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+// closeEvents releases blocked event forwarders and closes the events channel
+func (server *Server) closeEvents() {
+	close(server.done)
+
+	server.eventsLock.Lock()
+	defer server.eventsLock.Unlock()
+
+	server.eventsClosed = true
+
+	if server.events != nil {
+		close(server.events)
+	}
+}
+
+// closeBody closes the request body unless the request is an HTTP/3 CONNECT,
+// whose body is the stream of the upgraded WebTransport session
+func closeBody(request *http.Request) {
+	if request.Method == http.MethodConnect && request.ProtoMajor == 3 {
+		return
+	}
+
+	request.Body.Close()
+}
@@ -0,0 +1,818 @@
+package eio_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	eio "github.com/byonchev/go-engine.io"
+	"github.com/byonchev/go-engine.io/internal/codec"
+	"github.com/byonchev/go-engine.io/internal/packet"
+	"github.com/byonchev/go-engine.io/internal/protocol"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerPayloadTooLarge(t *testing.T) {
+	server := eio.NewServer()
+	server.MaxHTTPBufferSize = 10
+
+	closed := make(chan string, 1)
+
+	server.OnConnection(func(socket *eio.Socket) {
+		socket.OnClose(func(reason string) {
+			closed <- reason
+		})
+	})
+
+	endpoint := httptest.NewServer(server)
+	defer endpoint.Close()
+
+	sessionID := handshake(t, endpoint.URL)
+
+	url := endpoint.URL + "/?EIO=4&transport=polling&sid=" + sessionID
+
+	response, err := http.Post(url, "text/plain", strings.NewReader("4"+strings.Repeat("a", 100)))
+
+	assert.Nil(t, err, "post failed")
+	assert.Equal(t, http.StatusRequestEntityTooLarge, response.StatusCode, "oversized payload was accepted")
+
+	response.Body.Close()
+
+	select {
+	case reason := <-closed:
+		assert.Equal(t, "payload too large", reason, "wrong close reason")
+	case <-time.After(time.Second):
+		assert.Fail(t, "session was not closed")
+	}
+}
+
+func TestServerHeartbeatTimeout(t *testing.T) {
+	tests := []struct {
+		version string
+	}{
+		{"3"},
+		{"4"},
+	}
+
+	for _, test := range tests {
+		server := eio.NewServer()
+		server.PingInterval = 30 * time.Millisecond
+		server.PingTimeout = 30 * time.Millisecond
+
+		closed := make(chan string, 1)
+
+		server.OnConnection(func(socket *eio.Socket) {
+			socket.OnClose(func(reason string) {
+				closed <- reason
+			})
+		})
+
+		endpoint := httptest.NewServer(server)
+
+		started := time.Now()
+
+		response, err := http.Get(endpoint.URL + "/?EIO=" + test.version + "&transport=polling")
+
+		assert.Nil(t, err, "handshake failed")
+
+		response.Body.Close()
+
+		select {
+		case reason := <-closed:
+			assert.Equal(t, "ping timeout", reason, "wrong close reason for protocol v"+test.version)
+			assert.True(t, time.Since(started) >= server.PingInterval+server.PingTimeout, "session expired early for protocol v"+test.version)
+		case <-time.After(time.Second):
+			assert.Fail(t, "session did not expire for protocol v"+test.version)
+		}
+
+		server.Close()
+		endpoint.Close()
+	}
+}
+
+func TestServerHeartbeatV3Ping(t *testing.T) {
+	server := eio.NewServer()
+	server.PingInterval = 30 * time.Millisecond
+	server.PingTimeout = 30 * time.Millisecond
+
+	defer server.Close()
+
+	closed := make(chan string, 1)
+
+	server.OnConnection(func(socket *eio.Socket) {
+		socket.OnClose(func(reason string) {
+			closed <- reason
+		})
+	})
+
+	endpoint := httptest.NewServer(server)
+	defer endpoint.Close()
+
+	response, err := http.Get(endpoint.URL + "/?EIO=3&transport=polling")
+
+	assert.Nil(t, err, "handshake failed")
+
+	payload, _ := codec.XHR{Protocol: protocol.V3}.Decode(response.Body)
+	response.Body.Close()
+
+	url := endpoint.URL + "/?EIO=3&transport=polling&sid=" + sessionID(t, payload)
+
+	for i := 0; i < 10; i++ {
+		post, err := http.Post(url, "text/plain", strings.NewReader("1:2"))
+
+		assert.Nil(t, err, "ping was not sent")
+
+		post.Body.Close()
+
+		select {
+		case reason := <-closed:
+			assert.Fail(t, "session closed while client was pinging: "+reason)
+			return
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+}
+
+func TestServerParseError(t *testing.T) {
+	server := eio.NewServer()
+
+	closed := make(chan string, 1)
+
+	server.OnConnection(func(socket *eio.Socket) {
+		socket.OnClose(func(reason string) {
+			closed <- reason
+		})
+	})
+
+	endpoint := httptest.NewServer(server)
+	defer endpoint.Close()
+
+	sessionID := handshake(t, endpoint.URL)
+
+	url := endpoint.URL + "/?EIO=4&transport=polling&sid=" + sessionID
+
+	response, err := http.Post(url, "text/plain", strings.NewReader("9unknown"))
+
+	assert.Nil(t, err, "post failed")
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode, "invalid payload was accepted")
+
+	response.Body.Close()
+
+	select {
+	case reason := <-closed:
+		assert.Equal(t, "parse error", reason, "wrong close reason")
+	case <-time.After(time.Second):
+		assert.Fail(t, "session was not closed")
+	}
+}
+
+func TestServerEventsExistingSession(t *testing.T) {
+	server := eio.NewServer()
+	defer server.Close()
+
+	connected := make(chan string, 1)
+
+	server.OnConnection(func(socket *eio.Socket) {
+		connected <- socket.ID()
+	})
+
+	endpoint := httptest.NewServer(server)
+	defer endpoint.Close()
+
+	sessionID := handshake(t, endpoint.URL)
+
+	<-connected
+
+	events := server.Events()
+
+	url := endpoint.URL + "/?EIO=4&transport=polling&sid=" + sessionID
+
+	response, err := http.Post(url, "text/plain", strings.NewReader("4hello"))
+
+	assert.Nil(t, err, "post failed")
+
+	response.Body.Close()
+
+	expected := []interface{}{
+		eio.ConnectEvent{SessionID: sessionID},
+		eio.MessageEvent{SessionID: sessionID, Binary: false, Data: []byte("hello")},
+	}
+
+	for _, event := range expected {
+		select {
+		case received := <-events:
+			assert.Equal(t, event, received, "wrong event for existing session")
+		case <-time.After(time.Second):
+			assert.Fail(t, "event of existing session was not received")
+		}
+	}
+}
+
+func TestSocketDrainMessages(t *testing.T) {
+	server := eio.NewServer()
+	server.PingInterval = 10 * time.Millisecond
+	server.PingTimeout = time.Second
+
+	defer server.Close()
+
+	drained := make(chan struct{}, 10)
+
+	server.OnConnection(func(socket *eio.Socket) {
+		socket.OnDrain(func() {
+			drained <- struct{}{}
+		})
+	})
+
+	endpoint := httptest.NewServer(server)
+	defer endpoint.Close()
+
+	url := "ws" + strings.TrimPrefix(endpoint.URL, "http") + "/?EIO=4&transport=websocket"
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+
+	assert.Nil(t, err, "websocket was not opened")
+
+	defer conn.Close()
+
+	_, open, _ := conn.ReadMessage()
+
+	id := sessionID(t, packet.Payload{packet.NewOpen(open[1:])})
+
+	for i := 0; i < 3; i++ {
+		_, ping, _ := conn.ReadMessage()
+
+		assert.Equal(t, "2", string(ping), "ping was not sent")
+
+		conn.WriteMessage(websocket.TextMessage, []byte("3"))
+	}
+
+	select {
+	case <-drained:
+		assert.Fail(t, "pings drained the socket")
+	default:
+	}
+
+	server.Send(id, false, []byte("hello"))
+
+	select {
+	case <-drained:
+	case <-time.After(time.Second):
+		assert.Fail(t, "message did not drain the socket")
+	}
+}
+
+type namedTransport struct {
+	eio.Transport
+
+	name string
+}
+
+func (transport namedTransport) Type() string {
+	return transport.name
+}
+
+func TestServerRegisterTransport(t *testing.T) {
+	server := eio.NewServer()
+	server.Transports = append(server.Transports, "custom")
+
+	server.RegisterTransport("custom", func(protocol eio.ProtocolVersion, config eio.TransportConfig) eio.Transport {
+		return namedTransport{eio.NewPollingTransport(protocol, config), "custom"}
+	}, eio.TransportPolling)
+
+	other := eio.NewServer()
+	other.Transports = append(other.Transports, "custom")
+
+	endpoint := httptest.NewServer(server)
+	defer endpoint.Close()
+
+	otherEndpoint := httptest.NewServer(other)
+	defer otherEndpoint.Close()
+
+	tests := []struct {
+		url       string
+		transport string
+		status    int
+		upgrades  string
+	}{
+		{endpoint.URL, eio.TransportPolling, http.StatusOK, `"upgrades":["websocket","custom"]`},
+		{endpoint.URL, "custom", http.StatusOK, `"upgrades":[]`},
+		{otherEndpoint.URL, eio.TransportPolling, http.StatusOK, `"upgrades":["websocket"]`},
+		{otherEndpoint.URL, "custom", http.StatusBadRequest, ""},
+	}
+
+	for _, test := range tests {
+		response, err := http.Get(test.url + "/?EIO=4&transport=" + test.transport)
+
+		assert.Nil(t, err, "handshake failed")
+		assert.Equal(t, test.status, response.StatusCode, "wrong handshake status for "+test.transport)
+
+		body, _ := ioutil.ReadAll(response.Body)
+		response.Body.Close()
+
+		assert.Contains(t, string(body), test.upgrades, "wrong upgrades for "+test.transport)
+	}
+}
+
+type failingTransport struct {
+	eio.Transport
+}
+
+func (transport failingTransport) Receive() (eio.Packet, error) {
+	received, err := transport.Transport.Receive()
+
+	if err != nil {
+		return received, errors.New("connection lost")
+	}
+
+	return received, nil
+}
+
+func TestServerCustomTransportShutdown(t *testing.T) {
+	server := eio.NewServer()
+	server.MaxHTTPBufferSize = 10
+
+	server.RegisterTransport(eio.TransportPolling, func(protocol eio.ProtocolVersion, config eio.TransportConfig) eio.Transport {
+		return failingTransport{eio.NewPollingTransport(protocol, config)}
+	})
+
+	defer server.Close()
+
+	closed := make(chan string, 1)
+
+	server.OnConnection(func(socket *eio.Socket) {
+		socket.OnClose(func(reason string) {
+			closed <- reason
+		})
+	})
+
+	endpoint := httptest.NewServer(server)
+	defer endpoint.Close()
+
+	id := handshake(t, endpoint.URL)
+
+	url := endpoint.URL + "/?EIO=4&transport=polling&sid=" + id
+
+	response, err := http.Post(url, "text/plain", strings.NewReader("4"+strings.Repeat("a", 100)))
+
+	assert.Nil(t, err, "post failed")
+
+	response.Body.Close()
+
+	select {
+	case reason := <-closed:
+		assert.Equal(t, "transport error", reason, "wrong close reason")
+	case <-time.After(time.Second):
+		assert.Fail(t, "session was not closed after the transport was shut down")
+	}
+}
+
+func TestServerSSE(t *testing.T) {
+	server := eio.NewServer()
+	server.Transports = append(server.Transports, eio.TransportSSE)
+
+	received := make(chan string, 1)
+
+	server.OnConnection(func(socket *eio.Socket) {
+		socket.OnMessage(func(binary bool, data []byte) {
+			received <- string(data)
+		})
+	})
+
+	endpoint := httptest.NewServer(server)
+	defer endpoint.Close()
+
+	response, err := http.Get(endpoint.URL + "/?EIO=4&transport=sse")
+
+	assert.Nil(t, err, "event stream was not opened")
+
+	defer response.Body.Close()
+
+	handshake, _ := bufio.NewReader(response.Body).ReadString('\n')
+
+	assert.True(t, strings.HasPrefix(handshake, `data: "0{`), "handshake event was not received")
+
+	encoded, _ := strconv.Unquote(strings.TrimSpace(strings.TrimPrefix(handshake, "data: ")))
+	payload, _ := codec.XHR{Protocol: protocol.V4}.Decode(strings.NewReader(encoded))
+
+	url := endpoint.URL + "/?EIO=4&transport=sse&sid=" + sessionID(t, payload)
+
+	post, err := http.Post(url, "text/plain", strings.NewReader("4hello"))
+
+	assert.Nil(t, err, "post failed")
+	assert.Equal(t, http.StatusOK, post.StatusCode, "message was not accepted")
+
+	post.Body.Close()
+
+	select {
+	case message := <-received:
+		assert.Equal(t, "hello", message, "wrong message received")
+	case <-time.After(time.Second):
+		assert.Fail(t, "message was not received")
+	}
+}
+
+func TestServerServe(t *testing.T) {
+	tests := []struct {
+		network string
+		address string
+	}{
+		{"tcp", "127.0.0.1:0"},
+		{"unix", t.TempDir() + "/eio.sock"},
+	}
+
+	for _, test := range tests {
+		server := eio.NewServer()
+
+		received := make(chan string, 1)
+
+		server.OnConnection(func(socket *eio.Socket) {
+			socket.OnMessage(func(binary bool, data []byte) {
+				received <- string(data)
+			})
+		})
+
+		listener, err := net.Listen(test.network, test.address)
+
+		assert.Nil(t, err, "listener was not created")
+
+		go server.Serve(listener)
+
+		conn, err := net.Dial(test.network, listener.Addr().String())
+
+		assert.Nil(t, err, "client did not connect over "+test.network)
+
+		frames := codec.Framed{}
+		reader := bufio.NewReader(conn)
+
+		handshake, err := frames.Decode(reader)
+
+		assert.Nil(t, err, "handshake was not received")
+		assert.Equal(t, packet.Open, handshake[0].Type, "handshake packet was not sent")
+		assert.Contains(t, string(handshake[0].Data), `"upgrades":[]`, "upgrades were advertised")
+
+		id := sessionID(t, handshake)
+
+		frames.Encode(packet.Payload{packet.NewStringMessage("hello")}, conn)
+
+		select {
+		case message := <-received:
+			assert.Equal(t, "hello", message, "wrong message received")
+		case <-time.After(time.Second):
+			assert.Fail(t, "message was not received over "+test.network)
+		}
+
+		server.Send(id, true, []byte{1, 2, 3})
+
+		message, err := frames.Decode(reader)
+
+		assert.Nil(t, err, "message was not sent")
+		assert.Equal(t, packet.Payload{packet.NewBinaryMessage([]byte{1, 2, 3})}, message, "wrong message sent")
+
+		server.Close()
+
+		closing, _ := frames.Decode(reader)
+		_, err = frames.Decode(reader)
+
+		assert.Equal(t, packet.Payload{packet.NewClose()}, closing, "close packet was not sent")
+		assert.Error(t, err, "connection was not closed with the server")
+
+		conn.Close()
+		listener.Close()
+	}
+}
+
+func TestServerShutdownPolling(t *testing.T) {
+	tests := []struct {
+		name     string
+		pending  bool
+		expected string
+	}{
+		{"pending poll", true, "1"},
+		{"buffered packets", false, "4hello\x1e1"},
+	}
+
+	for _, test := range tests {
+		server := eio.NewServer()
+		events := collectEvents(server)
+
+		endpoint := httptest.NewServer(server)
+
+		id := handshake(t, endpoint.URL)
+
+		polled := make(chan string, 1)
+
+		if test.pending {
+			go func() { polled <- poll(t, endpoint.URL, id) }()
+
+			time.Sleep(50 * time.Millisecond)
+		} else {
+			server.Send(id, false, []byte("hello"))
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+
+		shutdown := make(chan error, 1)
+
+		go func() { shutdown <- server.Shutdown(ctx) }()
+
+		if !test.pending {
+			select {
+			case <-shutdown:
+				assert.Fail(t, "shutdown did not wait for buffered packets", test.name)
+			case <-time.After(50 * time.Millisecond):
+			}
+
+			go func() { polled <- poll(t, endpoint.URL, id) }()
+		}
+
+		assert.Equal(t, test.expected, <-polled, "close packet was not delivered: "+test.name)
+
+		select {
+		case err := <-shutdown:
+			assert.NoError(t, err, test.name)
+		case <-time.After(time.Second):
+			assert.Fail(t, "shutdown did not complete", test.name)
+		}
+
+		expected := []interface{}{
+			eio.ConnectEvent{SessionID: id},
+			eio.DisconnectEvent{SessionID: id, Reason: "server shutdown"},
+		}
+
+		assert.Equal(t, expected, <-events, "wrong events before close: "+test.name)
+		assert.True(t, eio.SchedulerStopped(server), "scheduler was not stopped: "+test.name)
+		assert.Error(t, server.Shutdown(ctx), "server was shut down twice: "+test.name)
+
+		cancel()
+		endpoint.Close()
+	}
+}
+
+func TestServerShutdownWebsocket(t *testing.T) {
+	server := eio.NewServer()
+	events := collectEvents(server)
+
+	endpoint := httptest.NewServer(server)
+	defer endpoint.Close()
+
+	url := "ws" + strings.TrimPrefix(endpoint.URL, "http") + "/?EIO=4&transport=websocket"
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+
+	assert.Nil(t, err, "websocket was not opened")
+
+	defer conn.Close()
+
+	_, open, _ := conn.ReadMessage()
+
+	id := sessionID(t, packet.Payload{packet.NewOpen(open[1:])})
+
+	server.Send(id, false, []byte("hello"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	assert.NoError(t, server.Shutdown(ctx), "shutdown failed")
+
+	_, message, _ := conn.ReadMessage()
+	_, closing, _ := conn.ReadMessage()
+	_, _, err = conn.ReadMessage()
+
+	assert.Equal(t, "4hello", string(message), "buffered message was not sent")
+	assert.Equal(t, "1", string(closing), "close packet was not sent")
+	assert.Error(t, err, "connection was not closed with the server")
+
+	expected := []interface{}{
+		eio.ConnectEvent{SessionID: id},
+		eio.DisconnectEvent{SessionID: id, Reason: "server shutdown"},
+	}
+
+	assert.Equal(t, expected, <-events, "wrong events before close")
+	assert.True(t, eio.SchedulerStopped(server), "scheduler was not stopped")
+	assert.Error(t, server.Close(), "server was closed twice")
+}
+
+func TestServerClose(t *testing.T) {
+	server := eio.NewServer()
+	events := collectEvents(server)
+
+	endpoint := httptest.NewServer(server)
+	defer endpoint.Close()
+
+	id := handshake(t, endpoint.URL)
+
+	server.Send(id, false, []byte("hello"))
+
+	closed := make(chan error, 1)
+
+	go func() { closed <- server.Close() }()
+
+	select {
+	case err := <-closed:
+		assert.NoError(t, err, "canceled context was returned")
+	case <-time.After(time.Second):
+		assert.Fail(t, "close waited for buffered packets")
+	}
+
+	select {
+	case <-events:
+	case <-time.After(time.Second):
+		assert.Fail(t, "events channel was not closed")
+	}
+
+	assert.True(t, eio.SchedulerStopped(server), "scheduler was not stopped")
+	assert.Error(t, server.Close(), "server was closed twice")
+}
+
+// collectEvents returns all server events once the events channel is closed
+func collectEvents(server *eio.Server) <-chan []interface{} {
+	result := make(chan []interface{}, 1)
+
+	events := server.Events()
+
+	go func() {
+		var received []interface{}
+
+		for event := range events {
+			received = append(received, event)
+		}
+
+		result <- received
+	}()
+
+	return result
+}
+
+func TestServerUpgradeMessageOrder(t *testing.T) {
+	server := eio.NewServer()
+	defer server.Close()
+
+	endpoint := httptest.NewServer(server)
+	defer endpoint.Close()
+
+	id := handshake(t, endpoint.URL)
+
+	send := func(messages ...string) {
+		for _, message := range messages {
+			server.Send(id, false, []byte(message))
+		}
+	}
+
+	send("before 1", "before 2")
+
+	assert.Equal(t, "4before 1\x1e4before 2", poll(t, endpoint.URL, id), "messages before probe were not polled")
+
+	url := "ws" + strings.TrimPrefix(endpoint.URL, "http") + "/?EIO=4&transport=websocket&sid=" + id
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+
+	assert.Nil(t, err, "websocket was not opened")
+
+	defer conn.Close()
+
+	conn.WriteMessage(websocket.TextMessage, []byte("2probe"))
+
+	_, probe, _ := conn.ReadMessage()
+
+	assert.Equal(t, "3probe", string(probe), "probe was not answered")
+
+	send("during 1", "during 2")
+
+	assert.Equal(t, "6", poll(t, endpoint.URL, id), "paused messages were polled")
+
+	conn.WriteMessage(websocket.TextMessage, []byte("5"))
+
+	send("after 1", "after 2")
+
+	expected := []string{"4during 1", "4during 2", "4after 1", "4after 2"}
+
+	for _, message := range expected {
+		_, received, err := conn.ReadMessage()
+
+		assert.Nil(t, err, "message was not received over websocket")
+		assert.Equal(t, message, string(received), "message was not delivered once and in order")
+	}
+
+	conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+
+	_, duplicate, err := conn.ReadMessage()
+
+	assert.Error(t, err, "unexpected message after upgrade: "+string(duplicate))
+}
+
+func TestServerUpgradeTimeout(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages []string
+	}{
+		{"probe withheld", nil},
+		{"upgrade withheld", []string{"2probe"}},
+	}
+
+	for _, test := range tests {
+		server := eio.NewServer()
+		server.UpgradeTimeout = 100 * time.Millisecond
+
+		events := server.Events()
+
+		endpoint := httptest.NewServer(server)
+
+		id := handshake(t, endpoint.URL)
+
+		<-events
+
+		url := "ws" + strings.TrimPrefix(endpoint.URL, "http") + "/?EIO=4&transport=websocket&sid=" + id
+
+		conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+
+		assert.Nil(t, err, "websocket was not opened: "+test.name)
+
+		for _, message := range test.messages {
+			conn.WriteMessage(websocket.TextMessage, []byte(message))
+		}
+
+		start := time.Now()
+
+		select {
+		case received := <-events:
+			expected := eio.UpgradeFailedEvent{SessionID: id, Transport: eio.TransportWebsocket, Reason: "upgrade timeout"}
+
+			assert.Equal(t, expected, received, "upgrade failure was not emitted: "+test.name)
+			assert.True(t, time.Since(start) >= 50*time.Millisecond, "upgrade failed before the timeout: "+test.name)
+		case <-time.After(time.Second):
+			assert.Fail(t, "upgrade did not time out", test.name)
+		}
+
+		server.Send(id, false, []byte("hello"))
+
+		assert.Contains(t, poll(t, endpoint.URL, id), "4hello", "polling stopped after failed upgrade: "+test.name)
+
+		post, err := http.Post(endpoint.URL+"/?EIO=4&transport=polling&sid="+id, "text/plain", strings.NewReader("4world"))
+
+		assert.Nil(t, err, "post failed: "+test.name)
+
+		post.Body.Close()
+
+		select {
+		case received := <-events:
+			assert.Equal(t, eio.MessageEvent{SessionID: id, Data: []byte("world")}, received, "polling stopped after failed upgrade: "+test.name)
+		case <-time.After(time.Second):
+			assert.Fail(t, "message was not received after failed upgrade", test.name)
+		}
+
+		conn.Close()
+		server.Close()
+		endpoint.Close()
+	}
+}
+
+func TestServerStalePollAfterUpgrade(t *testing.T) {
+	server := eio.NewServer()
+	defer server.Close()
+
+	events := server.Events()
+
+	endpoint := httptest.NewServer(server)
+	defer endpoint.Close()
+
+	id := handshake(t, endpoint.URL)
+
+	<-events
+
+	url := "ws" + strings.TrimPrefix(endpoint.URL, "http") + "/?EIO=4&transport=websocket&sid=" + id
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+
+	assert.Nil(t, err, "websocket was not opened")
+
+	defer conn.Close()
+
+	conn.WriteMessage(websocket.TextMessage, []byte("2probe"))
+	conn.ReadMessage()
+	conn.WriteMessage(websocket.TextMessage, []byte("5"))
+
+	assert.Equal(t, eio.UpgradeEvent{SessionID: id, Transport: eio.TransportWebsocket}, <-events, "transport was not upgraded")
+
+	response, err := http.Get(endpoint.URL + "/?EIO=4&transport=polling&sid=" + id)
+
+	assert.Nil(t, err, "stale poll failed")
+
+	response.Body.Close()
+
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode, "stale poll was accepted")
+
+	select {
+	case received := <-events:
+		assert.Fail(t, "stale poll emitted an event", "%#v", received)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -1,15 +1,19 @@
 package eio
 
 import (
+	"context"
 	"errors"
 	"io"
 	"net/http"
 	"sync"
-	"time"
 
+	"github.com/byonchev/go-engine.io/internal/codec"
 	"github.com/byonchev/go-engine.io/internal/config"
+	"github.com/byonchev/go-engine.io/internal/dispatch"
+	"github.com/byonchev/go-engine.io/internal/heartbeat"
 	"github.com/byonchev/go-engine.io/internal/logger"
 	"github.com/byonchev/go-engine.io/internal/packet"
+	"github.com/byonchev/go-engine.io/internal/protocol"
 	"github.com/byonchev/go-engine.io/internal/transport"
 	"github.com/byonchev/go-engine.io/internal/utils"
 )
@@ -18,43 +22,69 @@ import (
 type Session struct {
 	id                  string
 	config              config.Config
+	protocol            protocol.Version
 	supportedTransports map[string]bool
+	transports          *transport.Registry
 
-	transport transport.Transport
-
-	events chan<- interface{}
+	socket *Socket
+	events *dispatch.Queue
 
+	// guards the active transport and the session state.
+	// The transport is replaced while holding both stateLock and sendLock
+	stateLock  sync.RWMutex
+	transport  transport.Transport
 	handshaked bool
 	closed     bool
 
 	sending sync.WaitGroup
 
-	lastPingTime time.Time
+	sendLock sync.Mutex
+	paused   bool
+	backlog  packet.Payload
+
+	scheduler    *heartbeat.Scheduler
+	pingTimer    *heartbeat.Timer
+	timeoutTimer *heartbeat.Timer
+
+	onHandshake func(*Session)
+	onConnect   func(*Socket)
+	onClose     func(*Session)
 }
 
 // NewSession creates a new client session
-func NewSession(config config.Config, events chan<- interface{}) *Session {
+func NewSession(config config.Config, protocol protocol.Version, transports *transport.Registry, scheduler *heartbeat.Scheduler) *Session {
 	supportedTransports := make(map[string]bool)
 
 	for _, transport := range config.Transports {
 		supportedTransports[transport] = true
 	}
 
-	return &Session{
+	session := &Session{
 		id:                  utils.GenerateBase64ID(),
 		config:              config,
+		protocol:            protocol,
 		supportedTransports: supportedTransports,
+		transports:          transports,
 
-		events: events,
+		events: dispatch.NewQueue(config.EventQueueSize, config.EventQueueOverflow),
+
+		scheduler: scheduler,
 
 		handshaked: false,
 		closed:     false,
 	}
+
+	session.socket = newSocket(session)
+
+	session.pingTimer = scheduler.NewTimer(session.sendPing)
+	session.timeoutTimer = scheduler.NewTimer(session.expire)
+
+	return session
 }
 
 // HandleRequest is the bridge between the engine.io endpoint and the selected transport
 func (session *Session) HandleRequest(writer http.ResponseWriter, request *http.Request) {
-	defer request.Body.Close()
+	defer closeBody(request)
 
 	query := request.URL.Query()
 	requestedTransport := query.Get("transport")
@@ -66,60 +96,129 @@ func (session *Session) HandleRequest(writer http.ResponseWriter, request *http.
 		return
 	}
 
-	if session.transport == nil {
+	session.stateLock.Lock()
+
+	created := session.transport == nil
+
+	if created {
 		session.transport = session.createTransport(requestedTransport)
 	}
 
-	if !session.handshaked {
+	session.stateLock.Unlock()
+
+	if created {
 		go session.handshake()
 	}
 
 	if session.isUpgradeRequest(requestedTransport) {
+		// stale requests of a replaced transport are rejected without an upgrade attempt
+		if !session.upgradeSupported(requestedTransport) {
+			writer.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
 		err := session.upgrade(writer, request, requestedTransport)
 
 		if err != nil {
 			logger.Error("Transport upgrade error: ", err)
-			writer.WriteHeader(http.StatusBadRequest)
+
+			session.emit(UpgradeFailedEvent{SessionID: session.id, Transport: requestedTransport, Reason: err.Error()})
 		}
 
 		return
 	}
 
-	session.transport.HandleRequest(writer, request)
+	active := session.activeTransport()
+
+	active.HandleRequest(writer, request)
 }
 
-// Send enqueues packets for sending
+// serve starts the session on a transport bound to a connection
+// accepted outside of HTTP
+func (session *Session) serve(active transport.Transport) {
+	session.stateLock.Lock()
+	session.transport = active
+	session.stateLock.Unlock()
+
+	session.handshake()
+}
+
+// Send writes packet to the active transport.
+// While transport upgrade is in progress, packets are queued in the session
+// and delivered to the transport selected after the upgrade
 func (session *Session) Send(packet packet.Packet) error {
-	if session.closed {
+	if session.isClosed() {
 		return errors.New("session closed")
 	}
 
 	session.sending.Add(1)
-	err := session.transport.Send(packet)
-	session.sending.Done()
+	defer session.sending.Done()
 
-	return err
+	session.sendLock.Lock()
+	defer session.sendLock.Unlock()
+
+	if session.paused {
+		session.backlog = append(session.backlog, packet)
+
+		return nil
+	}
+
+	return session.write(packet)
 }
 
-// Close changes the session state and closes the channels
+// Socket returns the handle passed to connection handlers
+func (session *Session) Socket() *Socket {
+	return session.socket
+}
+
+// Close changes the session state and notifies the socket handlers
 func (session *Session) Close(reason string) {
+	session.stateLock.Lock()
+
 	if session.closed {
+		session.stateLock.Unlock()
 		return
 	}
 
 	session.closed = true
 
+	session.stateLock.Unlock()
+
+	session.stopHeartbeat()
+
 	session.sending.Wait()
 
-	if session.transport != nil {
-		session.transport.Shutdown()
+	if active := session.activeTransport(); active != nil {
+		// a pending poll still delivers the buffered packets
+		active.Shutdown()
 	}
 
 	session.debug("Session closed. Reason: ", reason)
 
-	session.emit(DisconnectEvent{session.id, reason})
+	session.emit(DisconnectEvent{SessionID: session.id, Reason: reason})
+	session.events.Close()
 
-	close(session.events)
+	if session.onClose != nil {
+		session.onClose(session)
+	}
+}
+
+// Shutdown sends close packet to the client and closes the session
+// after all buffered packets are delivered or the context is done
+func (session *Session) Shutdown(ctx context.Context) error {
+	var err error
+
+	if session.connected() {
+		err = session.Send(packet.NewClose())
+
+		if err == nil {
+			err = session.activeTransport().Drain(ctx)
+		}
+	}
+
+	session.Close("server shutdown")
+
+	return err
 }
 
 // ID returns the session ID
@@ -127,18 +226,20 @@ func (session *Session) ID() string {
 	return session.id
 }
 
-// Expired check if session is closed or last ping was not before (ping interval + ping timeout)
-func (session *Session) Expired() bool {
-	now := time.Now()
-	threshold := session.config.PingInterval + session.config.PingTimeout
+func (session *Session) handshake() {
+	packet := utils.CreateHandshakePacket(session.id, session.protocol, session.handshakeUpgrades(), session.config)
 
-	return session.closed || session.lastPingTime.Add(threshold).Before(now)
-}
+	// the handshake hook runs before any other packet can be sent
+	// so the session is reachable by the time the client receives its ID
+	session.sendLock.Lock()
 
-func (session *Session) handshake() {
-	packet := utils.CreateHandshakePacket(session.id, session.transport, session.config)
+	if session.onHandshake != nil {
+		session.onHandshake(session)
+	}
 
-	err := session.Send(packet)
+	err := session.write(packet)
+
+	session.sendLock.Unlock()
 
 	if err != nil {
 		logger.Error("Handshake error: ", err, "for", packet)
@@ -147,27 +248,85 @@ func (session *Session) handshake() {
 
 	session.debug("Session created")
 
+	session.stateLock.Lock()
 	session.handshaked = true
-	session.ping()
+	session.stateLock.Unlock()
+
+	session.startHeartbeat()
+
+	session.events.Force(session.connect)
 
 	go session.receivePackets()
+}
+
+func (session *Session) connect() {
+	if session.onConnect != nil {
+		session.onConnect(session.socket)
+	}
+}
+
+// startHeartbeat arms the session timers depending on the heartbeat direction.
+// Protocol v3 clients send pings and the session expires after PingInterval + PingTimeout
+// without packets. Protocol v4 clients answer server pings within PingTimeout
+func (session *Session) startHeartbeat() {
+	if session.protocol == protocol.V4 {
+		session.pingTimer.Reset(session.config.PingInterval)
+	} else {
+		session.timeoutTimer.Reset(session.config.PingInterval + session.config.PingTimeout)
+	}
+}
+
+func (session *Session) stopHeartbeat() {
+	session.pingTimer.Stop()
+	session.timeoutTimer.Stop()
+}
+
+func (session *Session) sendPing() {
+	if session.isClosed() {
+		return
+	}
+
+	session.debug("Sending ping")
+
+	session.timeoutTimer.Reset(session.config.PingTimeout)
+
+	err := session.Send(packet.NewPing(nil))
+
+	if err != nil {
+		logger.Error("Ping error: ", err)
 
-	session.emit(ConnectEvent{session.id})
+		session.emitError(err)
+	}
 }
 
-func (session *Session) ping() {
-	session.lastPingTime = time.Now()
+func (session *Session) expire() {
+	session.Close("ping timeout")
 }
 
 func (session *Session) receivePackets() {
-	for !session.closed {
-		transport := session.transport
+	for !session.isClosed() {
+		active := session.activeTransport()
+
+		received, err := active.Receive()
 
-		received, err := transport.Receive()
+		var decodeError *codec.DecodeError
+
+		if errors.As(err, &decodeError) {
+			logger.Error("Parse error: ", err)
+
+			session.Close("parse error")
+			return
+		}
 
 		switch err {
+		case transport.ErrPayloadTooLarge:
+			session.Close("payload too large")
+			return
+		case transport.ErrPollOverlap:
+			session.Close("transport error")
+			return
 		case io.EOF:
-			if !session.transport.Running() {
+			if !session.activeTransport().Running() {
 				session.Close("EOF")
 				return
 			}
@@ -177,16 +336,28 @@ func (session *Session) receivePackets() {
 			session.handlePacket(received)
 		default:
 			logger.Error("Receive error: ", err)
+
+			session.emitError(err)
+
+			// custom transports may fail with other errors than io.EOF once shut down
+			if !session.activeTransport().Running() {
+				session.Close("transport error")
+				return
+			}
 		}
 	}
 }
 
 func (session *Session) handlePacket(received packet.Packet) {
-	session.ping()
+	if session.protocol == protocol.V3 {
+		session.timeoutTimer.Reset(session.config.PingInterval + session.config.PingTimeout)
+	}
 
 	switch received.Type {
 	case packet.Ping:
 		session.handlePing(received)
+	case packet.Pong:
+		session.handlePong(received)
 	case packet.Close:
 		session.handleClose(received)
 	case packet.Message:
@@ -201,6 +372,17 @@ func (session *Session) handlePing(ping packet.Packet) {
 	session.Send(packet.NewPong(ping.Data))
 }
 
+func (session *Session) handlePong(pong packet.Packet) {
+	if session.protocol != protocol.V4 {
+		return
+	}
+
+	session.debug("Pong received")
+
+	session.timeoutTimer.Stop()
+	session.pingTimer.Reset(session.config.PingInterval)
+}
+
 func (session *Session) handleClose(close packet.Packet) {
 	session.Close("close packet received")
 }
@@ -214,28 +396,44 @@ func (session *Session) handleMessage(message packet.Packet) {
 		Data:      message.Data,
 	}
 
-	session.emit(event)
-}
+	err := session.events.Push(func() {
+		session.socket.handle(event)
+	})
 
-func (session *Session) upgrade(writer http.ResponseWriter, request *http.Request, target string) error {
-	if !session.upgradeSupported(target) {
-		return errors.New("not supported")
+	if err == dispatch.ErrOverflow {
+		logger.Error("Event queue overflow for session ", session.id)
+
+		go session.Close("event queue overflow")
 	}
+}
 
+// upgrade runs the probe and upgrade packet exchange on the candidate transport.
+// If the exchange is not completed within UpgradeTimeout or fails,
+// the candidate transport is closed and the session stays on the current one
+func (session *Session) upgrade(writer http.ResponseWriter, request *http.Request, target string) error {
 	upgrade := session.createTransport(target)
+
+	timeout := session.scheduler.AfterFunc(session.config.UpgradeTimeout, func() {
+		upgrade.Shutdown()
+	})
+
 	upgrade.HandleRequest(writer, request)
 
 	if !upgrade.Running() {
+		timeout.Stop()
+
 		return errors.New("transport failure")
 	}
 
 	session.debug("Upgrading transport")
 
+	defer session.resumeSending(nil)
+
 	for {
 		received, err := upgrade.Receive()
 
 		if err != nil {
-			return err
+			return session.abortUpgrade(upgrade, timeout, err)
 		}
 
 		if received.Type == packet.Ping && string(received.Data) == "probe" {
@@ -244,12 +442,14 @@ func (session *Session) upgrade(writer http.ResponseWriter, request *http.Reques
 			err := upgrade.Send(packet.NewPong(received.Data))
 
 			if err != nil {
-				return err
+				return session.abortUpgrade(upgrade, timeout, err)
 			}
 
 			session.debug("Poll cycle initiated")
 
-			session.transport.Send(packet.NewNOOP())
+			session.pauseSending()
+
+			session.activeTransport().Send(packet.NewNOOP())
 
 			continue
 		}
@@ -257,39 +457,180 @@ func (session *Session) upgrade(writer http.ResponseWriter, request *http.Reques
 		if received.Type == packet.Upgrade {
 			session.debug("Upgrade packet recevied")
 
-			session.transport.Shutdown()
-			session.transport = upgrade
+			if !timeout.Stop() {
+				return errors.New("upgrade timeout")
+			}
+
+			session.switchTransport(upgrade)
 
 			break
 		}
 	}
 
+	session.emit(UpgradeEvent{SessionID: session.id, Transport: target})
+
 	return nil
 }
 
+// abortUpgrade closes the candidate transport. If the upgrade timeout
+// has already closed it, the timeout is reported instead of the cause
+func (session *Session) abortUpgrade(upgrade transport.Transport, timeout *heartbeat.Timer, cause error) error {
+	if !timeout.Stop() {
+		return errors.New("upgrade timeout")
+	}
+
+	upgrade.Shutdown()
+
+	return cause
+}
+
+// switchTransport replaces the active transport and moves the packets
+// which were not delivered by the previous one to the new transport
+func (session *Session) switchTransport(upgrade transport.Transport) {
+	session.sendLock.Lock()
+	session.stateLock.Lock()
+
+	previous := session.transport
+
+	session.paused = true
+	session.transport = upgrade
+
+	session.stateLock.Unlock()
+	session.sendLock.Unlock()
+
+	var pending packet.Payload
+
+	for _, undelivered := range previous.Shutdown() {
+		if undelivered.Type != packet.NOOP {
+			pending = append(pending, undelivered)
+		}
+	}
+
+	session.resumeSending(pending)
+}
+
+func (session *Session) pauseSending() {
+	session.sendLock.Lock()
+	defer session.sendLock.Unlock()
+
+	session.paused = true
+}
+
+// resumeSending writes the pending packets followed by the packets queued
+// while sending was paused to the active transport
+func (session *Session) resumeSending(pending packet.Payload) {
+	session.sendLock.Lock()
+	defer session.sendLock.Unlock()
+
+	if !session.paused {
+		return
+	}
+
+	session.paused = false
+
+	backlog := append(pending, session.backlog...)
+
+	session.backlog = nil
+
+	for _, packet := range backlog {
+		err := session.write(packet)
+
+		if err != nil {
+			logger.Error("Error sending queued packet: ", err)
+
+			session.emitError(err)
+		}
+	}
+}
+
+func (session *Session) write(outgoing packet.Packet) error {
+	err := session.transport.Send(outgoing)
+
+	// buffered transports drain once a request delivers the packets,
+	// other transports once an application message is written
+	_, buffered := session.transport.(transport.Buffered)
+
+	if err == nil && outgoing.Type == packet.Message && !buffered {
+		session.emit(drainEvent{})
+	}
+
+	return err
+}
+
 func (session *Session) transportSupported(requested string) bool {
-	return session.supportedTransports[requested]
+	return session.supportedTransports[requested] && session.transports.Registered(requested)
 }
 
 func (session *Session) upgradeSupported(requested string) bool {
 	allowUpgrades := session.config.AllowUpgrades
-	possibleUpgrades := session.transport.Upgrades()
+	possibleUpgrades := session.transports.Upgrades(session.activeTransport().Type())
 
 	return allowUpgrades && utils.StringSliceContains(possibleUpgrades, requested)
 }
 
+// handshakeUpgrades returns the enabled transports the client can upgrade to
+func (session *Session) handshakeUpgrades() []string {
+	result := []string{}
+
+	if !session.config.AllowUpgrades {
+		return result
+	}
+
+	for _, upgrade := range session.transports.Upgrades(session.activeTransport().Type()) {
+		if session.supportedTransports[upgrade] {
+			result = append(result, upgrade)
+		}
+	}
+
+	return result
+}
+
 func (session *Session) isUpgradeRequest(requested string) bool {
-	return session.transport.Type() != requested
+	return session.activeTransport().Type() != requested
+}
+
+func (session *Session) activeTransport() transport.Transport {
+	session.stateLock.RLock()
+	defer session.stateLock.RUnlock()
+
+	return session.transport
+}
+
+// connected returns true if the session is open after the handshake
+func (session *Session) connected() bool {
+	session.stateLock.RLock()
+	defer session.stateLock.RUnlock()
+
+	return session.handshaked && !session.closed
+}
+
+func (session *Session) isClosed() bool {
+	session.stateLock.RLock()
+	defer session.stateLock.RUnlock()
+
+	return session.closed
 }
 
 func (session *Session) createTransport(requested string) transport.Transport {
-	return transport.NewTransport(requested, session.config)
+	created := session.transports.NewTransport(requested, session.protocol, session.config)
+
+	if buffered, ok := created.(transport.Buffered); ok {
+		buffered.OnFlush(func() {
+			session.emit(drainEvent{})
+		})
+	}
+
+	return created
 }
 
 func (session *Session) emit(event interface{}) {
-	go func() {
-		session.events <- event
-	}()
+	session.events.Force(func() {
+		session.socket.handle(event)
+	})
+}
+
+func (session *Session) emitError(err error) {
+	session.emit(ErrorEvent{SessionID: session.id, Error: err})
 }
 
 func (session *Session) debug(data ...interface{}) {
@@ -0,0 +1,147 @@
+package eio
+
+import (
+	"sync"
+
+	"github.com/byonchev/go-engine.io/internal/packet"
+)
+
+// Socket is the handle of a single connected client passed to connection handlers.
+// Handlers registered on a socket are called one at a time, in the order the session events occurred
+type Socket struct {
+	session *Session
+
+	sync.RWMutex
+
+	messageHandlers       []func(bool, []byte)
+	closeHandlers         []func(string)
+	upgradeHandlers       []func(string)
+	upgradeFailedHandlers []func(string, string)
+	errorHandlers         []func(error)
+	drainHandlers         []func()
+
+	// whether the events are forwarded to the server events channel
+	forwarding bool
+}
+
+func newSocket(session *Session) *Socket {
+	return &Socket{session: session}
+}
+
+// ID returns the session ID
+func (socket *Socket) ID() string {
+	return socket.session.ID()
+}
+
+// Send sends message to the client
+func (socket *Socket) Send(binary bool, data []byte) error {
+	return socket.session.Send(packet.NewMessage(binary, data))
+}
+
+// Close closes the client session
+func (socket *Socket) Close() {
+	socket.session.Close("forced close")
+}
+
+// OnMessage registers handler for messages received from the client
+func (socket *Socket) OnMessage(handler func(binary bool, data []byte)) {
+	socket.Lock()
+	defer socket.Unlock()
+
+	socket.messageHandlers = append(socket.messageHandlers, handler)
+}
+
+// OnClose registers handler for session close
+func (socket *Socket) OnClose(handler func(reason string)) {
+	socket.Lock()
+	defer socket.Unlock()
+
+	socket.closeHandlers = append(socket.closeHandlers, handler)
+}
+
+// OnUpgrade registers handler for completed transport upgrades
+func (socket *Socket) OnUpgrade(handler func(transport string)) {
+	socket.Lock()
+	defer socket.Unlock()
+
+	socket.upgradeHandlers = append(socket.upgradeHandlers, handler)
+}
+
+// OnUpgradeFailed registers handler for aborted transport upgrades
+func (socket *Socket) OnUpgradeFailed(handler func(transport string, reason string)) {
+	socket.Lock()
+	defer socket.Unlock()
+
+	socket.upgradeFailedHandlers = append(socket.upgradeFailedHandlers, handler)
+}
+
+// OnError registers handler for session errors
+func (socket *Socket) OnError(handler func(err error)) {
+	socket.Lock()
+	defer socket.Unlock()
+
+	socket.errorHandlers = append(socket.errorHandlers, handler)
+}
+
+// OnDrain registers handler called after buffered packets are written to the transport
+func (socket *Socket) OnDrain(handler func()) {
+	socket.Lock()
+	defer socket.Unlock()
+
+	socket.drainHandlers = append(socket.drainHandlers, handler)
+}
+
+func (socket *Socket) handle(event interface{}) {
+	socket.RLock()
+
+	messageHandlers := socket.messageHandlers
+	closeHandlers := socket.closeHandlers
+	upgradeHandlers := socket.upgradeHandlers
+	upgradeFailedHandlers := socket.upgradeFailedHandlers
+	errorHandlers := socket.errorHandlers
+	drainHandlers := socket.drainHandlers
+
+	socket.RUnlock()
+
+	switch event := event.(type) {
+	case MessageEvent:
+		for _, handler := range messageHandlers {
+			handler(event.Binary, event.Data)
+		}
+	case DisconnectEvent:
+		for _, handler := range closeHandlers {
+			handler(event.Reason)
+		}
+	case UpgradeEvent:
+		for _, handler := range upgradeHandlers {
+			handler(event.Transport)
+		}
+	case UpgradeFailedEvent:
+		for _, handler := range upgradeFailedHandlers {
+			handler(event.Transport, event.Reason)
+		}
+	case ErrorEvent:
+		for _, handler := range errorHandlers {
+			handler(event.Error)
+		}
+	case drainEvent:
+		for _, handler := range drainHandlers {
+			handler()
+		}
+	}
+}
+
+// startForwarding marks the socket events as forwarded.
+// Returns false if they already are
+func (socket *Socket) startForwarding() bool {
+	socket.Lock()
+	defer socket.Unlock()
+
+	if socket.forwarding {
+		return false
+	}
+
+	socket.forwarding = true
+
+	return true
+}
@@ -0,0 +1,71 @@
+package eio
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrUnknownSession is returned by session stores for sessions without owner
+var ErrUnknownSession = errors.New("unknown session")
+
+// SessionStore keeps track of the nodes owning the sessions.
+// Servers sharing a store forward requests to the node which created the session
+type SessionStore interface {
+	// Register marks the node address as owner of the session
+	Register(sessionID string, node string) error
+
+	// Owner returns the address of the node owning the session
+	Owner(sessionID string) (string, error)
+
+	// Remove deletes the session owner
+	Remove(sessionID string) error
+}
+
+// MemoryStore is an in-process session store.
+// It can be shared by servers running in the same process
+type MemoryStore struct {
+	sync.RWMutex
+
+	owners map[string]string
+}
+
+// NewMemoryStore creates an empty in-process session store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		owners: make(map[string]string),
+	}
+}
+
+// Register marks the node address as owner of the session
+func (store *MemoryStore) Register(sessionID string, node string) error {
+	store.Lock()
+	defer store.Unlock()
+
+	store.owners[sessionID] = node
+
+	return nil
+}
+
+// Owner returns the address of the node owning the session
+func (store *MemoryStore) Owner(sessionID string) (string, error) {
+	store.RLock()
+	defer store.RUnlock()
+
+	node, found := store.owners[sessionID]
+
+	if !found {
+		return "", ErrUnknownSession
+	}
+
+	return node, nil
+}
+
+// Remove deletes the session owner
+func (store *MemoryStore) Remove(sessionID string) error {
+	store.Lock()
+	defer store.Unlock()
+
+	delete(store.owners, sessionID)
+
+	return nil
+}
@@ -0,0 +1,131 @@
+package eio_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	eio "github.com/byonchev/go-engine.io"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryStore(t *testing.T) {
+	store := eio.NewMemoryStore()
+
+	err := store.Register("session", "http://node")
+
+	assert.Nil(t, err, "session was not registered")
+
+	owner, err := store.Owner("session")
+
+	assert.Nil(t, err, "owner lookup failed")
+	assert.Equal(t, "http://node", owner, "wrong session owner")
+
+	store.Remove("session")
+
+	_, err = store.Owner("session")
+
+	assert.Equal(t, eio.ErrUnknownSession, err, "removed session still has owner")
+}
+
+func TestServerForwardsToOwner(t *testing.T) {
+	store := eio.NewMemoryStore()
+
+	messages := make(chan string, 1)
+
+	owner := eio.NewServer()
+	owner.OnConnection(func(socket *eio.Socket) {
+		socket.OnMessage(func(binary bool, data []byte) {
+			messages <- string(data)
+		})
+	})
+
+	first := startNode(owner, store)
+	defer first.Close()
+
+	second := startNode(eio.NewServer(), store)
+	defer second.Close()
+
+	sessionID := handshake(t, first.URL)
+
+	url := second.URL + "/?EIO=4&transport=polling&sid=" + sessionID
+
+	response, err := http.Post(url, "text/plain", strings.NewReader("4hello"))
+
+	assert.Nil(t, err, "forwarded post failed")
+	assert.Equal(t, http.StatusOK, response.StatusCode, "post was not forwarded to owner")
+
+	response.Body.Close()
+
+	select {
+	case message := <-messages:
+		assert.Equal(t, "hello", message, "wrong message received by owner")
+	case <-time.After(time.Second):
+		assert.Fail(t, "message was not received by owner")
+	}
+}
+
+func TestServerRegisterOutsideLock(t *testing.T) {
+	store := &blockingStore{
+		MemoryStore: eio.NewMemoryStore(),
+		entered:     make(chan struct{}),
+		release:     make(chan struct{}),
+	}
+
+	server := eio.NewServer()
+	defer server.Close()
+
+	endpoint := startNode(server, store)
+	defer endpoint.Close()
+
+	opened := make(chan string, 1)
+
+	go func() {
+		opened <- handshake(t, endpoint.URL)
+	}()
+
+	<-store.entered
+
+	joined := make(chan error, 1)
+
+	go func() {
+		joined <- server.Join("unknown", "room")
+	}()
+
+	select {
+	case err := <-joined:
+		assert.Error(t, err, "unknown session joined")
+	case <-time.After(time.Second):
+		assert.Fail(t, "server was locked while registering session")
+	}
+
+	close(store.release)
+
+	assert.NotEmpty(t, <-opened, "session was not opened after registration")
+}
+
+// blockingStore waits to be released before registering sessions
+type blockingStore struct {
+	*eio.MemoryStore
+
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (store *blockingStore) Register(sessionID string, node string) error {
+	close(store.entered)
+
+	<-store.release
+
+	return store.MemoryStore.Register(sessionID, node)
+}
+
+func startNode(server *eio.Server, store eio.SessionStore) *httptest.Server {
+	node := httptest.NewServer(server)
+
+	server.SetSessionStore(store, node.URL)
+
+	return node
+}
@@ -0,0 +1,93 @@
+package eio
+
+import (
+	"github.com/byonchev/go-engine.io/internal/config"
+	"github.com/byonchev/go-engine.io/internal/packet"
+	"github.com/byonchev/go-engine.io/internal/protocol"
+	"github.com/byonchev/go-engine.io/internal/transport"
+)
+
+// Names of the built-in transports
+const (
+	TransportPolling      = transport.PollingType
+	TransportWebsocket    = transport.WebsocketType
+	TransportWebTransport = transport.WebTransportType
+	TransportSSE          = transport.SSEType
+	TransportRaw          = transport.RawType
+)
+
+// Protocol revisions passed to transport factories
+const (
+	ProtocolV3 = protocol.V3
+	ProtocolV4 = protocol.V4
+)
+
+// Packet types exchanged through the transports
+const (
+	PacketOpen    = packet.Open
+	PacketClose   = packet.Close
+	PacketPing    = packet.Ping
+	PacketPong    = packet.Pong
+	PacketMessage = packet.Message
+	PacketUpgrade = packet.Upgrade
+	PacketNOOP    = packet.NOOP
+)
+
+// Transport handles the delivery of packets between the client and the server.
+// Receive must block until a packet arrives. Once the transport is shut down,
+// Receive must return an error and Running must report false, which closes the session
+type Transport = transport.Transport
+
+// TransportFactory creates a transport for a new session or upgrade request
+type TransportFactory = transport.Factory
+
+// TransportConfig holds the server settings passed to transport factories
+type TransportConfig = config.Config
+
+// StreamUpgrader upgrades the request to a byte stream opened by the client.
+// The closer is called once the transport is stopped.
+// On error the upgrader has already responded to the request
+type StreamUpgrader = transport.StreamUpgrader
+
+// ProtocolVersion is the engine.io protocol revision spoken by a client
+type ProtocolVersion = protocol.Version
+
+// Packet is a single engine.io packet
+type Packet = packet.Packet
+
+// Payload is a sequence of packets
+type Payload = packet.Payload
+
+// PacketType defines the packet type
+type PacketType = packet.Type
+
+// RegisterTransport makes a transport available to the server sessions under the given name.
+// Clients can upgrade to it from every transport listed in upgradesFrom and
+// it is advertised in their handshake. The transport must also be enabled in
+// the server Transports setting. Registering an existing name replaces it.
+// Other servers in the process are not affected
+func (server *Server) RegisterTransport(name string, factory TransportFactory, upgradesFrom ...string) {
+	server.transports.Register(name, factory, upgradesFrom...)
+}
+
+// NewPollingTransport creates the built-in polling transport with the server settings.
+// Custom transports can wrap it to change parts of its behaviour
+func NewPollingTransport(protocol ProtocolVersion, config TransportConfig) Transport {
+	return transport.CreatePolling(protocol, config)
+}
+
+// NewWebsocketTransport creates the built-in websocket transport with the server settings
+func NewWebsocketTransport(protocol ProtocolVersion, config TransportConfig) Transport {
+	return transport.CreateWebsocket(protocol, config)
+}
+
+// NewSSETransport creates the built-in event stream transport with the server settings
+func NewSSETransport(protocol ProtocolVersion, config TransportConfig) Transport {
+	return transport.CreateSSE(protocol, config)
+}
+
+// NewStreamTransport creates a transport with the given name which exchanges
+// length-prefixed packets over the byte stream returned by the upgrader
+func NewStreamTransport(name string, upgrader StreamUpgrader, config TransportConfig) Transport {
+	return transport.NewStream(name, upgrader, config.MaxHTTPBufferSize, config.CheckOrigin)
+}
@@ -0,0 +1,68 @@
+// Package webtransport adds the WebTransport transport over HTTP/3 to engine.io servers.
+// It is kept apart from the server so only its importers depend on the QUIC stack
+package webtransport
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	eio "github.com/byonchev/go-engine.io"
+	webtransportgo "github.com/quic-go/webtransport-go"
+)
+
+// acceptTimeout limits the wait for the client to open the packet stream
+const acceptTimeout = 10 * time.Second
+
+// Register makes WebTransport available to the server sessions.
+// Protocol v4 clients can upgrade to it from polling once it is enabled
+// in the server Transports setting. The HTTP/3 server of the WebTransport
+// server must serve the engine.io endpoint
+func Register(server *eio.Server, webTransportServer *webtransportgo.Server) {
+	factory := func(protocol eio.ProtocolVersion, config eio.TransportConfig) eio.Transport {
+		upgrader := createUpgrader(webTransportServer, protocol)
+
+		return eio.NewStreamTransport(eio.TransportWebTransport, upgrader, config)
+	}
+
+	server.RegisterTransport(eio.TransportWebTransport, factory, eio.TransportPolling)
+}
+
+// createUpgrader returns upgrader of the CONNECT requests to WebTransport sessions
+// which waits for the client to open a single bidirectional stream
+func createUpgrader(server *webtransportgo.Server, protocol eio.ProtocolVersion) eio.StreamUpgrader {
+	return func(writer http.ResponseWriter, request *http.Request) (io.ReadWriter, func(), error) {
+		if protocol != eio.ProtocolV4 {
+			writer.WriteHeader(http.StatusBadRequest)
+
+			return nil, nil, errors.New("WebTransport requires protocol v4")
+		}
+
+		session, err := server.Upgrade(writer, request)
+
+		if err != nil {
+			writer.WriteHeader(http.StatusBadRequest)
+
+			return nil, nil, err
+		}
+
+		closer := func() {
+			session.CloseWithError(0, "")
+		}
+
+		ctx, cancel := context.WithTimeout(session.Context(), acceptTimeout)
+		defer cancel()
+
+		stream, err := session.AcceptStream(ctx)
+
+		if err != nil {
+			closer()
+
+			return nil, nil, err
+		}
+
+		return stream, closer, nil
+	}
+}
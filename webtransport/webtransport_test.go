@@ -0,0 +1,203 @@
+package webtransport_test
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	eio "github.com/byonchev/go-engine.io"
+	"github.com/byonchev/go-engine.io/internal/codec"
+	"github.com/byonchev/go-engine.io/internal/packet"
+	"github.com/byonchev/go-engine.io/internal/protocol"
+	"github.com/byonchev/go-engine.io/internal/utils"
+	"github.com/byonchev/go-engine.io/webtransport"
+	"github.com/quic-go/quic-go/http3"
+	webtransportgo "github.com/quic-go/webtransport-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebTransportUpgrade(t *testing.T) {
+	server := eio.NewServer()
+	server.Transports = append(server.Transports, eio.TransportWebTransport)
+
+	upgraded := make(chan string, 1)
+
+	server.OnConnection(func(socket *eio.Socket) {
+		socket.OnUpgrade(func(transport string) {
+			upgraded <- transport
+		})
+	})
+
+	address, roots, closeServer := serve(t, server)
+	defer closeServer()
+
+	endpoint := httptest.NewServer(server)
+	defer endpoint.Close()
+
+	opened := handshake(t, endpoint.URL, protocol.V4)
+
+	assert.Equal(t, []string{"websocket", "webtransport"}, opened.Upgrades, "webtransport upgrade was not advertised")
+
+	sessionID := opened.SessionID
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	dialer := webtransportgo.Dialer{TLSClientConfig: &tls.Config{RootCAs: roots}}
+
+	_, session, err := dialer.Dial(ctx, "https://"+address+"/?EIO=4&transport=webtransport&sid="+sessionID, nil)
+
+	assert.Nil(t, err, "client did not connect")
+
+	defer session.CloseWithError(0, "")
+
+	stream, err := session.OpenStreamSync(ctx)
+
+	assert.Nil(t, err, "client did not open stream")
+
+	frames := codec.Framed{}
+	reader := bufio.NewReader(stream)
+
+	open := packet.NewOpen([]byte(`{"sid":"` + sessionID + `"}`))
+
+	frames.Encode(packet.Payload{open, packet.NewPing([]byte("probe"))}, stream)
+
+	pong, err := frames.Decode(reader)
+
+	assert.Nil(t, err, "probe was not answered")
+	assert.Equal(t, packet.Payload{packet.NewPong([]byte("probe"))}, pong, "wrong probe response")
+
+	frames.Encode(packet.Payload{packet.NewUpgrade()}, stream)
+
+	select {
+	case transport := <-upgraded:
+		assert.Equal(t, eio.TransportWebTransport, transport, "wrong upgrade transport")
+	case <-time.After(time.Second):
+		assert.Fail(t, "session was not upgraded")
+	}
+
+	server.Send(sessionID, false, []byte("hello"))
+
+	message, err := frames.Decode(reader)
+
+	assert.Nil(t, err, "message was not received")
+	assert.Equal(t, packet.Payload{packet.NewStringMessage("hello")}, message, "wrong message received")
+}
+
+func TestWebTransportProtocolV3(t *testing.T) {
+	server := eio.NewServer()
+	server.Transports = append(server.Transports, eio.TransportWebTransport)
+
+	address, roots, closeServer := serve(t, server)
+	defer closeServer()
+
+	endpoint := httptest.NewServer(server)
+	defer endpoint.Close()
+
+	sessionID := handshake(t, endpoint.URL, protocol.V3).SessionID
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	dialer := webtransportgo.Dialer{TLSClientConfig: &tls.Config{RootCAs: roots}}
+
+	reply, _, err := dialer.Dial(ctx, "https://"+address+"/?EIO=3&transport=webtransport&sid="+sessionID, nil)
+
+	assert.Error(t, err, "protocol v3 client upgraded to webtransport")
+
+	if assert.NotNil(t, reply, "upgrade was not answered") {
+		assert.Equal(t, http.StatusBadRequest, reply.StatusCode, "wrong status for protocol v3 upgrade")
+	}
+}
+
+// handshake opens a polling session and returns the handshake sent by the server
+func handshake(t *testing.T, url string, version protocol.Version) utils.Handshake {
+	response, err := http.Get(url + "/?EIO=" + strconv.Itoa(int(version)) + "&transport=polling")
+
+	assert.Nil(t, err, "handshake failed")
+
+	defer response.Body.Close()
+
+	payload, err := codec.XHR{Protocol: version}.Decode(response.Body)
+
+	assert.Nil(t, err, "handshake was not decoded")
+
+	if !assert.NotEmpty(t, payload, "open packet was not received") {
+		return utils.Handshake{}
+	}
+
+	parsed, err := utils.ParseHandshakePacket(payload[0])
+
+	assert.Nil(t, err, "handshake was not parsed")
+
+	return parsed
+}
+
+// serve registers WebTransport on the server and serves it over QUIC on loopback.
+// It returns the server address and the roots trusting its certificate
+func serve(t *testing.T, server *eio.Server) (string, *x509.CertPool, func()) {
+	certificate, roots := createCertificate(t)
+
+	webTransportServer := &webtransportgo.Server{
+		H3: &http3.Server{
+			Handler: server,
+			TLSConfig: &tls.Config{
+				Certificates: []tls.Certificate{certificate},
+				NextProtos:   []string{http3.NextProtoH3},
+			},
+		},
+	}
+
+	webtransportgo.ConfigureHTTP3Server(webTransportServer.H3)
+
+	webtransport.Register(server, webTransportServer)
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+
+	assert.Nil(t, err, "udp listener was not created")
+
+	go webTransportServer.Serve(conn)
+
+	return conn.LocalAddr().String(), roots, func() {
+		webTransportServer.Close()
+		conn.Close()
+	}
+}
+
+// createCertificate returns a self-signed certificate for the loopback address
+func createCertificate(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	assert.Nil(t, err, "key was not generated")
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+
+	assert.Nil(t, err, "certificate was not created")
+
+	leaf, _ := x509.ParseCertificate(der)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(leaf)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, roots
+}